@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carldanley/hexapod/pkg/hexapod"
+	"github.com/carldanley/hexapod/pkg/i2c"
+	"github.com/carldanley/hexapod/pkg/pca9685"
+	"github.com/carldanley/hexapod/pkg/servos"
+	"github.com/carldanley/hexapod/pkg/simulator"
+)
+
+const calibrationHelp = `commands:
+  +[n]  nudge the pwm up by n steps (default 1)
+  -[n]  nudge the pwm down by n steps (default 1)
+  c     record the current pwm as the centre
+  n     record the current pwm as the min limit
+  x     record the current pwm as the max limit
+  p     print the current pwm and recorded values
+  s     save this servo and move on to the next one
+  k     skip this servo without saving
+  q     save this servo and quit
+  ?     show this help`
+
+const calibrationMoveDuration = 250 * time.Millisecond
+
+type calibrationBoard struct {
+	controller servos.Controller
+	close      func()
+}
+
+type calibrationSession struct {
+	device    string
+	simulated bool
+	step      int
+	scanner   *bufio.Scanner
+	scheduler *servos.Scheduler
+	boards    map[uint8]calibrationBoard
+}
+
+type calibrationResult int
+
+const (
+	calibrationSaved calibrationResult = iota
+	calibrationSkipped
+	calibrationQuit
+	calibrationAborted
+)
+
+func runCalibrate(args []string) error {
+	flags := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	file := flags.String("file", servos.DefaultCalibrationPath, "calibration file to read and write")
+	device := flags.String("device", hexapod.DefaultDevice, "i2c device the servo boards are on")
+	simulated := flags.Bool("sim", false, "drive simulated boards instead of real hardware")
+	step := flags.Int("step", 1, "pwm change for a single nudge")
+	only := flags.String("servo", "", "only calibrate the named servo (ie - RightLeg1_Coxa)")
+	flags.Parse(args)
+
+	// start from whatever was calibrated previously (if anything)
+	calibration, _, err := servos.LoadCalibrationOrDefault(*file)
+	if err != nil {
+		return err
+	}
+
+	session := &calibrationSession{
+		device:    *device,
+		simulated: *simulated,
+		step:      *step,
+		scanner:   bufio.NewScanner(os.Stdin),
+		scheduler: servos.NewScheduler(servos.DefaultSchedulerTickRate),
+		boards:    map[uint8]calibrationBoard{},
+	}
+
+	session.scheduler.Start()
+	defer session.close()
+
+	fmt.Println(calibrationHelp)
+
+	for _, layout := range hexapod.DefaultLayout {
+		for i, name := range layout.GetServoNames() {
+			if (*only != "") && (name != *only) {
+				continue
+			}
+
+			board, err := session.getBoard(layout.Address)
+			if err != nil {
+				return err
+			}
+
+			result, err := session.calibrateServo(name, layout.ChannelOffset+i, board.controller, calibration)
+			if err != nil {
+				return err
+			}
+
+			// persist as we go so a crash doesn't throw away the servos already done
+			if (result == calibrationSaved) || (result == calibrationQuit) {
+				if err := calibration.Save(*file); err != nil {
+					return err
+				}
+
+				fmt.Printf("saved %s to %s\n", name, *file)
+			}
+
+			if (result == calibrationQuit) || (result == calibrationAborted) {
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+func (cs *calibrationSession) getBoard(address uint8) (calibrationBoard, error) {
+	if board, ok := cs.boards[address]; ok {
+		return board, nil
+	}
+
+	board := calibrationBoard{}
+
+	if cs.simulated {
+		controller := simulator.New(address)
+		board.controller = controller
+		board.close = func() {
+			controller.Reset()
+		}
+	} else {
+		slave, err := i2c.New(address, cs.device)
+		if err != nil {
+			return board, err
+		}
+
+		controller, err := pca9685.New(slave, &pca9685.Options{
+			Frequency:  50,
+			ClockSpeed: 26430000,
+		})
+
+		if err != nil {
+			slave.Close()
+			return board, err
+		}
+
+		board.controller = controller
+		board.close = func() {
+			controller.Reset()
+			slave.Close()
+		}
+	}
+
+	cs.boards[address] = board
+	return board, nil
+}
+
+func (cs *calibrationSession) close() {
+	cs.scheduler.Stop()
+
+	for _, board := range cs.boards {
+		board.close()
+	}
+}
+
+func (cs *calibrationSession) calibrateServo(name string, channel int, controller servos.Controller, calibration *servos.Calibration) (calibrationResult, error) {
+	// servos that haven't been calibrated yet start from the built in calibration, so
+	// they keep its direction
+	recorded, ok := calibration.Servos[name]
+	if !ok {
+		if recorded, ok = servos.DefaultCalibration().Servos[name]; !ok {
+			recorded = servos.NewServoCalibration(servos.ServoType_DS3225_135)
+		}
+	}
+
+	current, err := recorded.ServoType()
+	if err != nil {
+		return calibrationQuit, err
+	}
+
+	// use a servo type without any trims or limits so the whole hardware range can be explored
+	halfAngle := current.GetMaxHardwareAngle() / 2
+	open, err := servos.NewServoType(current.GetMinHardwarePWM(), current.GetMaxHardwarePWM(), 0, current.GetMaxHardwareAngle(), -halfAngle, halfAngle)
+	if err != nil {
+		return calibrationQuit, err
+	}
+
+	pwm := float32(math.Round(float64(current.GetCenterLimitPWM())))
+	servo, err := servos.New(channel, controller, open, open.ConvertPWMToAngle(int(pwm)))
+	if err != nil {
+		return calibrationQuit, err
+	}
+
+	cs.scheduler.Register(servo)
+	defer cs.scheduler.Unregister(servo)
+
+	centerPWM := current.GetCenterLimitPWM()
+	minPWM := current.GetMinLimitPWM()
+	maxPWM := current.GetMaxLimitPWM()
+
+	fmt.Printf("\ncalibrating %s (channel %d), starting at pwm %d\n", name, channel, int(pwm))
+
+	for {
+		fmt.Printf("%s> ", name)
+		if !cs.scanner.Scan() {
+			return calibrationAborted, cs.scanner.Err()
+		}
+
+		command := strings.TrimSpace(cs.scanner.Text())
+		if command == "" {
+			continue
+		}
+
+		switch command[0] {
+		case '+', '-':
+			steps, err := parseNudge(command)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+
+			pwm += float32(steps * cs.step)
+			pwm = float32(math.Max(float64(open.GetMinLimitPWM()), math.Min(float64(open.GetMaxLimitPWM()), float64(pwm))))
+			servo.MoveToPWM(pwm, calibrationMoveDuration)
+			fmt.Printf("pwm: %d\n", int(pwm))
+		case 'c':
+			centerPWM = pwm
+			fmt.Printf("centre recorded at pwm %d\n", int(centerPWM))
+		case 'n':
+			minPWM = pwm
+			fmt.Printf("min limit recorded at pwm %d\n", int(minPWM))
+		case 'x':
+			maxPWM = pwm
+			fmt.Printf("max limit recorded at pwm %d\n", int(maxPWM))
+		case 'p':
+			fmt.Printf("pwm: %d, centre: %d, min: %d, max: %d\n", int(pwm), int(centerPWM), int(minPWM), int(maxPWM))
+		case 'k':
+			return calibrationSkipped, nil
+		case 's', 'q':
+			if len(recorded.CalibrationTable) > 0 {
+				if err := recordTableCalibration(&recorded, centerPWM, minPWM, maxPWM); err != nil {
+					fmt.Printf("can't save %s: %s\n", name, err)
+					continue
+				}
+			} else {
+				recorded.CenterPWMOffset = int(math.Round(float64(centerPWM - open.GetMidHardwarePWM())))
+				recorded.MinLimitAngle = (minPWM - centerPWM) / pwmPerDegree(open)
+				recorded.MaxLimitAngle = (maxPWM - centerPWM) / pwmPerDegree(open)
+			}
+
+			// don't let a bad set of recordings into the file
+			if _, err := recorded.ServoType(); err != nil {
+				fmt.Printf("can't save %s: %s\n", name, err)
+				continue
+			}
+
+			calibration.Servos[name] = recorded
+
+			if command[0] == 'q' {
+				return calibrationQuit, nil
+			}
+
+			return calibrationSaved, nil
+		default:
+			fmt.Println(calibrationHelp)
+		}
+	}
+}
+
+// recordTableCalibration handles servos with a calibration table, which replaces the
+// linear centre offset and limits; the table is shifted so its centre lands on
+// centerPWM, and the limits are converted to angles through the shifted table
+func recordTableCalibration(recorded *servos.ServoCalibration, centerPWM, minPWM, maxPWM float32) error {
+	// limit angles are recorded as the servo sees them, before any inversion
+	unshifted := *recorded
+	unshifted.Inverted = false
+
+	current, err := unshifted.ServoType()
+	if err != nil {
+		return err
+	}
+
+	shift := centerPWM - current.GetCenterLimitPWM()
+	table := []servos.CalibrationPoint{}
+	for _, point := range recorded.CalibrationTable {
+		table = append(table, servos.CalibrationPoint{
+			Angle: point.Angle,
+			PWM:   point.PWM + shift,
+		})
+	}
+
+	// open the limits up to the whole table so any recorded pwm converts
+	shifted := unshifted
+	shifted.CalibrationTable = table
+	shifted.MinLimitAngle, shifted.MaxLimitAngle = table[0].Angle, table[0].Angle
+	for _, point := range table {
+		shifted.MinLimitAngle = float32(math.Min(float64(shifted.MinLimitAngle), float64(point.Angle)))
+		shifted.MaxLimitAngle = float32(math.Max(float64(shifted.MaxLimitAngle), float64(point.Angle)))
+	}
+
+	st, err := shifted.ServoType()
+	if err != nil {
+		return err
+	}
+
+	recorded.CalibrationTable = table
+	recorded.CenterPWMOffset = int(math.Round(float64(centerPWM - st.GetMidHardwarePWM())))
+	recorded.MinLimitAngle = st.ConvertPWMToAngle(int(math.Round(float64(minPWM))))
+	recorded.MaxLimitAngle = st.ConvertPWMToAngle(int(math.Round(float64(maxPWM))))
+
+	return nil
+}
+
+func parseNudge(command string) (int, error) {
+	direction := 1
+	if command[0] == '-' {
+		direction = -1
+	}
+
+	if len(command) == 1 {
+		return direction, nil
+	}
+
+	steps, err := strconv.Atoi(command[1:])
+	if err != nil || steps < 0 {
+		return 0, fmt.Errorf("invalid nudge: %s", command)
+	}
+
+	return direction * steps, nil
+}
+
+func pwmPerDegree(st servos.ServoType) float32 {
+	return float32(st.GetMaxHardwarePWM()-st.GetMinHardwarePWM()) / st.GetMaxHardwareAngle()
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"fmt"
+	"log"
 	"os"
 	"os/signal"
 	"syscall"
@@ -10,13 +12,36 @@ import (
 
 var signalChannel chan os.Signal
 
+var commands = map[string]func(args []string) error{
+	"calibrate": runCalibrate,
+	"workspace": runWorkspace,
+}
+
 func init() {
 	signalChannel = make(chan os.Signal, 1)
 	signal.Notify(signalChannel, os.Interrupt, syscall.SIGINT)
 }
 
 func main() {
-	var testServoType = servos.NewServoType(135, 538, 0, 270.0, -90.0, 90.0)
+	if len(os.Args) > 1 {
+		command, ok := commands[os.Args[1]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown command: %s\n", os.Args[1])
+			os.Exit(2)
+		}
+
+		if err := command(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	testServoType, err := servos.NewServoType(135, 538, 0, 270.0, -90.0, 90.0)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	testServoType.DebugOutput()
 
 	// <-signalChannel
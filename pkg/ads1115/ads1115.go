@@ -0,0 +1,168 @@
+package ads1115
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/carldanley/hexapod/pkg/i2c"
+)
+
+const (
+	DefaultAddress = 0x48
+
+	// Taken from: https://www.ti.com/lit/ds/symlink/ads1115.pdf
+	ConversionRegister byte = 0x00
+	ConfigRegister     byte = 0x01
+
+	ConfigStartSingle      uint16 = 0x8000
+	ConfigMuxSingleEnded   uint16 = 0x4000
+	ConfigModeSingleShot   uint16 = 0x0100
+	ConfigComparatorOff    uint16 = 0x0003
+	ConfigMuxShift                = 12
+	ConfigGainShift               = 9
+	ConfigDataRateShift           = 5
+	ConfigConversionIsDone uint16 = 0x8000
+
+	ChannelCount = 4
+)
+
+type Gain uint16
+
+// full scale ranges, in volts
+const (
+	Gain6_144V Gain = iota
+	Gain4_096V
+	Gain2_048V
+	Gain1_024V
+	Gain0_512V
+	Gain0_256V
+)
+
+var fullScaleVoltages = map[Gain]float32{
+	Gain6_144V: 6.144,
+	Gain4_096V: 4.096,
+	Gain2_048V: 2.048,
+	Gain1_024V: 1.024,
+	Gain0_512V: 0.512,
+	Gain0_256V: 0.256,
+}
+
+type DataRate uint16
+
+// samples per second
+const (
+	DataRate8 DataRate = iota
+	DataRate16
+	DataRate32
+	DataRate64
+	DataRate128
+	DataRate250
+	DataRate475
+	DataRate860
+)
+
+var samplesPerSecond = map[DataRate]int{
+	DataRate8:   8,
+	DataRate16:  16,
+	DataRate32:  32,
+	DataRate64:  64,
+	DataRate128: 128,
+	DataRate250: 250,
+	DataRate475: 475,
+	DataRate860: 860,
+}
+
+type ADS1115 struct {
+	mutex   sync.Mutex
+	i2c     *i2c.Options
+	options *Options
+}
+
+type Options struct {
+	Gain     Gain
+	DataRate DataRate
+}
+
+func New(i2c *i2c.Options, options *Options) (*ADS1115, error) {
+	address := i2c.GetAddr()
+	if address == 0 {
+		return nil, fmt.Errorf("I2C device is not initialized")
+	}
+
+	ads := &ADS1115{
+		i2c: i2c,
+		options: &Options{
+			Gain:     Gain4_096V,
+			DataRate: DataRate860,
+		},
+	}
+
+	if options != nil {
+		if _, ok := fullScaleVoltages[options.Gain]; !ok {
+			return nil, fmt.Errorf("invalid gain value")
+		}
+
+		if _, ok := samplesPerSecond[options.DataRate]; !ok {
+			return nil, fmt.Errorf("invalid data rate value")
+		}
+
+		ads.options = options
+	}
+
+	return ads, nil
+}
+
+// ReadChannel takes a single shot, single ended reading of the given input (0-3)
+func (ads *ADS1115) ReadChannel(channel int) (int16, error) {
+	if (channel < 0) || (channel >= ChannelCount) {
+		return 0, fmt.Errorf("invalid channel value")
+	}
+
+	ads.mutex.Lock()
+	defer ads.mutex.Unlock()
+
+	config := ConfigStartSingle |
+		ConfigMuxSingleEnded | (uint16(channel) << ConfigMuxShift) |
+		(uint16(ads.options.Gain) << ConfigGainShift) |
+		ConfigModeSingleShot |
+		(uint16(ads.options.DataRate) << ConfigDataRateShift) |
+		ConfigComparatorOff
+
+	if err := ads.i2c.WriteRegU16BE(ConfigRegister, config); err != nil {
+		return 0, err
+	}
+
+	// give the conversion time to happen, then make sure it actually finished
+	conversionTime := time.Second / time.Duration(samplesPerSecond[ads.options.DataRate])
+	time.Sleep(conversionTime + 100*time.Microsecond)
+
+	for attempt := 0; ; attempt++ {
+		status, err := ads.i2c.ReadRegU16BE(ConfigRegister)
+		if err != nil {
+			return 0, err
+		}
+
+		if status&ConfigConversionIsDone != 0 {
+			break
+		}
+
+		if attempt >= 10 {
+			return 0, fmt.Errorf("conversion did not finish")
+		}
+
+		time.Sleep(conversionTime / 10)
+	}
+
+	return ads.i2c.ReadRegS16BE(ConversionRegister)
+}
+
+// ReadVoltage takes a reading of the given input (0-3) and converts it to volts
+func (ads *ADS1115) ReadVoltage(channel int) (float32, error) {
+	counts, err := ads.ReadChannel(channel)
+	if err != nil {
+		return 0, err
+	}
+
+	return float32(counts) * fullScaleVoltages[ads.options.Gain] / 32768, nil
+}
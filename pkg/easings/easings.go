@@ -317,3 +317,43 @@ func ElasticInOut(t, b, c, d float32) float32 {
 	postFix := a * float32(math.Pow(2, -10*(float64(t))))
 	return postFix*float32(math.Sin(float64(t*d-s)*(2*math.Pi)/float64(p)))*0.5 + c + b
 }
+
+// Func is the signature shared by every easing function in this package
+type Func func(t, b, c, d float32) float32
+
+var byName = map[string]Func{
+	"LinearNone":   LinearNone,
+	"LinearIn":     LinearIn,
+	"LinearOut":    LinearOut,
+	"LinearInOut":  LinearInOut,
+	"SineIn":       SineIn,
+	"SineOut":      SineOut,
+	"SineInOut":    SineInOut,
+	"CircIn":       CircIn,
+	"CircOut":      CircOut,
+	"CircInOut":    CircInOut,
+	"CubicIn":      CubicIn,
+	"CubicOut":     CubicOut,
+	"CubicInOut":   CubicInOut,
+	"QuadIn":       QuadIn,
+	"QuadOut":      QuadOut,
+	"QuadInOut":    QuadInOut,
+	"ExpoIn":       ExpoIn,
+	"ExpoOut":      ExpoOut,
+	"ExpoInOut":    ExpoInOut,
+	"BackIn":       BackIn,
+	"BackOut":      BackOut,
+	"BackInOut":    BackInOut,
+	"BounceIn":     BounceIn,
+	"BounceOut":    BounceOut,
+	"BounceInOut":  BounceInOut,
+	"ElasticIn":    ElasticIn,
+	"ElasticOut":   ElasticOut,
+	"ElasticInOut": ElasticInOut,
+}
+
+// Lookup finds an easing function by its name (ie - "SineInOut")
+func Lookup(name string) (Func, bool) {
+	easing, ok := byName[name]
+	return easing, ok
+}
@@ -0,0 +1,578 @@
+// Package gait walks the hexapod by moving its feet in cartesian space on every
+// scheduler tick
+package gait
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/carldanley/hexapod/pkg/geometry"
+	"github.com/carldanley/hexapod/pkg/hexapod"
+	"github.com/carldanley/hexapod/pkg/legs"
+)
+
+// leg indexes, in the order of hexapod.DefaultLayout
+const (
+	RightLeg1 = iota
+	RightLeg2
+	RightLeg3
+	LeftLeg1
+	LeftLeg2
+	LeftLeg3
+
+	LegCount
+)
+
+type Options struct {
+	// the longest distance (in millimetres) a foot travels while it's on the ground,
+	// which caps the walking speed
+	StrideLength float64
+
+	// how high (in millimetres) a foot is lifted while it swings forward
+	StepHeight float64
+
+	// how long one full cycle (every leg lifting once) takes
+	CycleTime time.Duration
+
+	// the fraction of the cycle each foot spends on the ground; left at 0, the gait's
+	// minimum is used
+	DutyFactor float64
+
+	// how far (in millimetres) the centre of mass has to stay inside the feet left on
+	// the ground for a leg to be allowed to lift; a leg that can't lift waits
+	MinStabilityMargin float64
+}
+
+var DefaultOptions = Options{
+	StrideLength:       80,
+	StepHeight:         40,
+	CycleTime:          time.Second,
+	MinStabilityMargin: 10,
+}
+
+// ErrHalted is returned by Stop when the hexapod took the legs back (or another
+// controller took them over) before the gait could finish
+var ErrHalted = errors.New("the gait was halted")
+
+// ErrSchedulerStopped is returned by Stop when the hexapod's scheduler stops (ie - on
+// Shutdown) before the gait could finish
+var ErrSchedulerStopped = errors.New("the scheduler stopped before the gait finished")
+
+// a leg can never have fewer than this many feet on the ground when it lifts
+const minFeetDown = 3
+
+// how quickly (in cycles per cycle) a leg that was held down catches back up with
+// the gait's pattern
+const delayRecoveryRate = 0.25
+
+// dutyFactorTolerance lets a duty factor like 0.8333 count as the 5/6 a wave gait needs
+const dutyFactorTolerance = 1e-3
+
+type footState struct {
+	neutral  geometry.Vector
+	position geometry.Vector
+	liftoff  geometry.Vector
+	landing  geometry.Vector
+	swinging bool
+}
+
+// Engine walks the hexapod with a gait; feet on the ground slide backwards against
+// the commanded twist while the others swing forward to land ahead
+type Engine struct {
+	mutex       sync.Mutex
+	hexapod     *hexapod.Hexapod
+	gait        Gait
+	options     Options
+	offsets     []float64
+	delays      []float64
+	transition  *transition
+	twist       Twist
+	targetTwist Twist
+	feet        []footState
+	phase       float64
+	cycles      float64
+	lastTick    time.Time
+	running     bool
+	stopping    bool
+	stopLeft    float64
+	err         error
+	done        chan bool
+}
+
+func New(hp *hexapod.Hexapod, gait Gait, options *Options) (*Engine, error) {
+	if hp.GetLegCount() != LegCount {
+		return nil, fmt.Errorf("a %s gait needs %d legs, the hexapod has %d", gait.Name(), LegCount, hp.GetLegCount())
+	}
+
+	opts, err := gaitOptions(gait, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Engine{
+		hexapod: hp,
+		gait:    gait,
+		options: opts,
+		offsets: gait.PhaseOffsets(),
+	}, nil
+}
+
+// gaitOptions fills in and checks the options for the given gait
+func gaitOptions(gait Gait, options *Options) (Options, error) {
+	opts := DefaultOptions
+	if options != nil {
+		opts = *options
+	}
+
+	if opts.DutyFactor == 0 {
+		opts.DutyFactor = gait.MinDutyFactor()
+	}
+
+	if err := validateOptions(opts); err != nil {
+		return Options{}, err
+	}
+
+	// any less time on the ground and too many legs would be up at once
+	if opts.DutyFactor < gait.MinDutyFactor()-dutyFactorTolerance {
+		return Options{}, fmt.Errorf("a %s gait needs a duty factor of at least %f, got %f", gait.Name(), gait.MinDutyFactor(), opts.DutyFactor)
+	}
+
+	return opts, nil
+}
+
+func (e *Engine) GetGait() Gait {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.gait
+}
+
+func (e *Engine) GetOptions() Options {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.options
+}
+
+func validateOptions(options Options) error {
+	if options.StrideLength <= 0 {
+		return fmt.Errorf("stride length must be positive")
+	}
+
+	if options.StepHeight <= 0 {
+		return fmt.Errorf("step height must be positive")
+	}
+
+	if options.CycleTime <= 0 {
+		return fmt.Errorf("cycle time must be positive")
+	}
+
+	if options.MinStabilityMargin < 0 {
+		return fmt.Errorf("minimum stability margin must not be negative")
+	}
+
+	if (options.DutyFactor <= 0) || (options.DutyFactor >= 1) {
+		return fmt.Errorf("duty factor must be between 0 and 1, got %f", options.DutyFactor)
+	}
+
+	return nil
+}
+
+// Start begins walking on the spot around the hexapod's stance (which is fixed where
+// the feet are if it's only been estimated, see hexapod.TakeLegs); use SetTwist or
+// SetVelocity to get moving
+func (e *Engine) Start() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.running {
+		return fmt.Errorf("gait is already running")
+	}
+
+	e.hexapod.TakeLegs(e, hexapod.Footwork{
+		StepHeight:   e.options.StepHeight,
+		StrideLength: e.options.StrideLength,
+	})
+
+	// the feet step over to the hexapod's stance as they go
+	stance := e.hexapod.GetStance()
+
+	e.feet = []footState{}
+	for i := 0; i < e.hexapod.GetLegCount(); i++ {
+		leg := e.hexapod.GetLeg(i)
+		angles := leg.GetTargetAngles()
+		_, foot := leg.ForwardKinematics(angles.Coxa, angles.Femur, angles.Tibia)
+
+		e.feet = append(e.feet, footState{
+			neutral:  e.hexapod.GetNeutralFoot(i, stance),
+			position: foot,
+		})
+	}
+
+	e.twist = Twist{}
+	e.targetTwist = Twist{}
+	e.delays = make([]float64, len(e.feet))
+	e.phase = 0
+	e.lastTick = time.Time{}
+	e.running = true
+	e.stopping = false
+	e.err = nil
+	e.done = make(chan bool)
+
+	e.hexapod.GetScheduler().AddTask(e)
+
+	return nil
+}
+
+// Stop brings the robot to a halt, letting every leg take one more step back to its
+// neutral position, and waits for that to finish
+func (e *Engine) Stop() error {
+	e.mutex.Lock()
+	if !e.running {
+		defer e.mutex.Unlock()
+		return e.err
+	}
+
+	if !e.stopping {
+		e.stopping = true
+		e.stopLeft = 1
+		e.targetTwist = Twist{}
+	}
+
+	done := e.done
+	e.mutex.Unlock()
+
+	// the gait only moves on with the scheduler's ticks, so there's no waiting for
+	// it to finish once the scheduler has stopped
+	select {
+	case <-done:
+	case <-e.hexapod.GetScheduler().Done():
+		e.halt(ErrSchedulerStopped)
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.err
+}
+
+// Halt stops the gait straight away, leaving the feet wherever they are; it's how the
+// hexapod takes the legs back (see hexapod.LegController)
+func (e *Engine) Halt() {
+	e.halt(ErrHalted)
+}
+
+// halt stops the gait straight away, leaving the feet wherever they are
+func (e *Engine) halt(err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.running {
+		e.finish(err)
+	}
+}
+
+func (e *Engine) IsRunning() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.running
+}
+
+func (e *Engine) stanceTime() time.Duration {
+	return stanceTime(e.options)
+}
+
+func stanceTime(options Options) time.Duration {
+	return time.Duration(float64(options.CycleTime) * options.DutyFactor)
+}
+
+// lateness is how much longer than the stance time a foot can stay on the ground: it
+// only lifts on the first tick after its stance is over
+func (e *Engine) lateness() time.Duration {
+	return e.hexapod.GetScheduler().GetTickRate()
+}
+
+// Tick moves every foot along for this tick; it only ever runs on the scheduler's
+// goroutine
+func (e *Engine) Tick(now time.Time) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// halted between ticks
+	if !e.running {
+		return false
+	}
+
+	elapsed := time.Duration(0)
+	if !e.lastTick.IsZero() {
+		elapsed = now.Sub(e.lastTick)
+	}
+
+	e.lastTick = now
+	step := elapsed.Seconds() / e.options.CycleTime.Seconds()
+	e.phase = math.Mod(e.phase+step, 1)
+	e.cycles += step
+
+	e.updateTransition()
+	e.followStance()
+	e.updateTwist(elapsed)
+	e.keepFeetInReach(elapsed)
+
+	previous := append([]footState{}, e.feet...)
+	for i := range e.feet {
+		e.moveFoot(i, elapsed, step)
+	}
+
+	if err := e.placeFeet(now); err != nil {
+		// stopping here would leave any foot in the air hanging there, so the feet stay
+		// where they were for this tick (ie - a foot passing between two of the points
+		// its step was checked at)
+		if !anySwinging(previous) {
+			e.finish(err)
+			return false
+		}
+
+		e.feet = previous
+	}
+
+	// stance changes have to leave room for the steps the feet are taking
+	e.hexapod.UpdateStrides(e, e.strides())
+
+	// give every leg a cycle to step back to neutral once the robot has stopped
+	if e.stopping && e.twist.IsZero() {
+		e.stopLeft -= step
+		if e.stopLeft <= 0 {
+			e.finish(nil)
+			return false
+		}
+	}
+
+	return true
+}
+
+// legPhase returns where a leg is in its own cycle
+func (e *Engine) legPhase(index int) float64 {
+	phase := math.Mod(e.phase+e.offsets[index]+e.delays[index], 1)
+	if phase < 0 {
+		phase++
+	}
+
+	return phase
+}
+
+// moveFoot works out where a foot should be at this point in its cycle
+func (e *Engine) moveFoot(index int, elapsed time.Duration, step float64) {
+	foot := &e.feet[index]
+	phase := e.legPhase(index)
+
+	// hold the foot down if lifting it now would leave the robot unstable; it picks
+	// up its place in the pattern again over the next few cycles
+	if (phase >= e.options.DutyFactor) && !foot.swinging && !e.canLift(index) {
+		e.delays[index] -= phase - e.options.DutyFactor + 1e-6
+		phase = e.legPhase(index)
+	} else if !foot.swinging && (e.delays[index] < 0) {
+		e.delays[index] = math.Min(0, e.delays[index]+delayRecoveryRate*step)
+	}
+
+	if phase < e.options.DutyFactor {
+		// on the ground: the foot stays put in the world, so it slides backwards under
+		// the body (turning about the centre of rotation) as the body moves forwards
+		if foot.swinging {
+			foot.swinging = false
+			foot.position.Z = foot.neutral.Z
+		}
+
+		foot.position = e.twist.move(foot.position, -elapsed.Seconds())
+		return
+	}
+
+	if !foot.swinging {
+		foot.swinging = true
+		foot.liftoff = foot.position
+		foot.landing = e.landingAt(index, e.twist, 1)
+	}
+
+	// in the air: the landing spot follows the twist, for as long as there's one the
+	// foot can step to
+	if landing, ok := e.landing(index, foot.liftoff, e.twist); ok {
+		foot.landing = landing
+	}
+
+	progress := (phase - e.options.DutyFactor) / (1 - e.options.DutyFactor)
+	foot.position = legs.Step{
+		From:   foot.liftoff,
+		To:     foot.landing,
+		Height: e.options.StepHeight,
+	}.PointAt(progress)
+}
+
+// landing returns where a foot that lifted off at liftoff should land: far enough
+// ahead that it ends up back at neutral halfway through its next stance, pulled back
+// towards neutral if the leg can't reach that far (or step there from liftoff). It
+// returns false if the foot can't step to either.
+func (e *Engine) landing(index int, liftoff geometry.Vector, twist Twist) (geometry.Vector, bool) {
+	if e.canLand(index, liftoff, twist, 1) {
+		return e.landingAt(index, twist, 1), true
+	}
+
+	if !e.canLand(index, liftoff, twist, 0) {
+		return geometry.Vector{}, false
+	}
+
+	lowest, highest := 0.0, 1.0
+	for i := 0; i < twistSearchSteps; i++ {
+		middle := (lowest + highest) / 2
+		if e.canLand(index, liftoff, twist, middle) {
+			lowest = middle
+		} else {
+			highest = middle
+		}
+	}
+
+	return e.landingAt(index, twist, lowest), true
+}
+
+// landingAt returns the landing spot fraction of the way from neutral to the one
+// ahead for the twist
+func (e *Engine) landingAt(index int, twist Twist, fraction float64) geometry.Vector {
+	neutral := e.feet[index].neutral
+	ahead := twist.move(neutral, e.stanceTime().Seconds()/2)
+
+	return neutral.Add(ahead.Sub(neutral).Scale(fraction))
+}
+
+// canLand checks a leg can step from liftoff to the landing spot fraction of the way
+// from neutral to the one ahead for the twist
+func (e *Engine) canLand(index int, liftoff geometry.Vector, twist Twist, fraction float64) bool {
+	return canStep(e.hexapod.GetLeg(index), legs.Step{
+		From:   liftoff,
+		To:     e.landingAt(index, twist, fraction),
+		Height: e.options.StepHeight,
+	})
+}
+
+// strides returns how far and which way each foot travels along the ground in a
+// step at the current twist, from landing to liftoff
+func (e *Engine) strides() []geometry.Vector {
+	halfStance := e.stanceTime().Seconds() / 2
+	late := e.lateness().Seconds()
+
+	strides := []geometry.Vector{}
+	for _, foot := range e.feet {
+		landing := e.twist.move(foot.neutral, halfStance)
+		liftoff := e.twist.move(foot.neutral, -(halfStance + late))
+		strides = append(strides, liftoff.Sub(landing))
+	}
+
+	return strides
+}
+
+// anySwinging reports whether any of the feet are in the air
+func anySwinging(feet []footState) bool {
+	for _, foot := range feet {
+		if foot.swinging {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canLift reports whether enough feet would be left on the ground, with the centre of
+// mass far enough inside them, for the leg to lift
+func (e *Engine) canLift(index int) bool {
+	support := []geometry.Vector{}
+	for i, foot := range e.feet {
+		if (i != index) && !foot.swinging {
+			support = append(support, foot.position)
+		}
+	}
+
+	if len(support) < minFeetDown {
+		return false
+	}
+
+	return geometry.PolygonMargin(geometry.ConvexHull(support), e.hexapod.GetCenterOfMass()) >= e.options.MinStabilityMargin
+}
+
+// placeFeet solves every leg before moving any, so a foot out of reach stops the
+// gait with the legs still in a consistent pose
+func (e *Engine) placeFeet(now time.Time) error {
+	solutions := []legs.JointAngles{}
+	for i, foot := range e.feet {
+		leg := e.hexapod.GetLeg(i)
+		angles, err := leg.InverseKinematics(foot.position)
+		if err != nil {
+			return fmt.Errorf("leg %d: %w", i, err)
+		}
+
+		solutions = append(solutions, angles)
+	}
+
+	for i, angles := range solutions {
+		leg := e.hexapod.GetLeg(i)
+		leg.SetJointAnglesAt(angles, now)
+
+		// only the feet on the ground hold the body up
+		if e.feet[i].swinging {
+			leg.SetHoldingLoad(0)
+		} else {
+			leg.SetHoldingLoad(1)
+		}
+	}
+
+	return nil
+}
+
+// followStance moves the neutral foot positions along with the hexapod's stance (ie -
+// raising the body while walking). Feet on the ground only follow the height, since
+// moving them sideways would drag them; a new spread is picked up as each foot
+// swings over to its new neutral position and lands there.
+func (e *Engine) followStance() {
+	if !e.hexapod.HasStance() {
+		return
+	}
+
+	stance := e.hexapod.GetStance()
+
+	moved := false
+	for i := range e.feet {
+		foot := &e.feet[i]
+		shift := e.hexapod.GetNeutralFoot(i, stance).Sub(foot.neutral)
+		if shift.Length() == 0 {
+			continue
+		}
+
+		moved = true
+		foot.neutral = foot.neutral.Add(shift)
+
+		// a swinging foot heads for a landing spot worked out from neutral, and its
+		// height is too
+		if !foot.swinging {
+			foot.position.Z += shift.Z
+		}
+	}
+
+	// the legs' reach changes with the stance, so the twist might not fit any more
+	if moved {
+		e.targetTwist = e.limitTwist(e.targetTwist, e.options)
+	}
+}
+
+func (e *Engine) finish(err error) {
+	e.err = err
+	e.running = false
+
+	// any foot left in the air is assumed to be back on the ground
+	for i := 0; i < e.hexapod.GetLegCount(); i++ {
+		leg := e.hexapod.GetLeg(i)
+		leg.SetHoldingLoad(1)
+	}
+
+	e.hexapod.ReleaseLegs(e)
+	close(e.done)
+}
@@ -0,0 +1,144 @@
+package gait
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/carldanley/hexapod/pkg/geometry"
+	"github.com/carldanley/hexapod/pkg/hexapod"
+	"github.com/carldanley/hexapod/pkg/servos"
+)
+
+// simulation steps a simulated hexapod through time one scheduler tick at a time, so
+// a walk comes out the same on every run however busy the machine is
+type simulation struct {
+	hexapod *hexapod.Hexapod
+	now     time.Time
+}
+
+func newSimulation(t *testing.T) *simulation {
+	t.Helper()
+
+	hp, err := hexapod.New(&hexapod.Options{
+		Simulated:   true,
+		Calibration: servos.DefaultCalibration(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(hp.Shutdown)
+
+	// the ticks come from the test from here on
+	hp.GetScheduler().Stop()
+
+	err = hp.Startup(&hexapod.StartupSequence{
+		Groups:      [][]int{{0, 1, 2, 3, 4, 5}},
+		InitialPose: hexapod.StartupPose,
+		RestPose:    hexapod.StandingPose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sim := &simulation{hexapod: hp, now: time.Now()}
+	sim.run(time.Second)
+
+	return sim
+}
+
+func (sim *simulation) run(duration time.Duration) {
+	scheduler := sim.hexapod.GetScheduler()
+	end := sim.now.Add(duration)
+
+	for sim.now.Before(end) {
+		sim.now = sim.now.Add(scheduler.GetTickRate())
+		scheduler.Step(sim.now)
+	}
+}
+
+// walk starts a gait at the twist, giving it time to get up to speed
+func (sim *simulation) walk(t *testing.T, gait Gait, twist Twist) (*Engine, Twist) {
+	t.Helper()
+
+	engine, err := New(sim.hexapod, gait, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := engine.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	limited := engine.SetTwist(twist)
+	sim.run(1500 * time.Millisecond)
+
+	return engine, limited
+}
+
+func checkWalking(t *testing.T, engine *Engine) {
+	t.Helper()
+
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+
+	if !engine.running {
+		t.Fatalf("the gait stopped: %v", engine.err)
+	}
+}
+
+func TestFullTwist(t *testing.T) {
+	twists := []Twist{
+		{Velocity: geometry.Vector{X: 1000}},
+		{Velocity: geometry.Vector{X: -1000}},
+		{Velocity: geometry.Vector{Y: 1000}},
+		{Velocity: geometry.Vector{Y: -1000}},
+		{YawRate: 1000},
+		{YawRate: -1000},
+	}
+
+	for _, gait := range []Gait{Tripod{}, Ripple{}, Wave{}} {
+		for _, twist := range twists {
+			t.Run(fmt.Sprintf("%s %s %.0f", gait.Name(), twist.Velocity, twist.YawRate), func(t *testing.T) {
+				sim := newSimulation(t)
+				engine, limited := sim.walk(t, gait, twist)
+
+				// a few more cycles at full speed, where the feet are furthest out
+				sim.run(3 * time.Second)
+				checkWalking(t, engine)
+
+				got := engine.GetTwist()
+				if (got.Velocity.Sub(limited.Velocity).Length() > 1e-3) || (math.Abs(got.YawRate-limited.YawRate) > 1e-3) {
+					t.Errorf("twist = %v, want %v", got, limited)
+				}
+			})
+		}
+	}
+}
+
+func TestSetBodyHeightWhileWalking(t *testing.T) {
+	for _, height := range []float64{60, 80, 110, 140, 180} {
+		t.Run(fmt.Sprintf("%.0fmm", height), func(t *testing.T) {
+			sim := newSimulation(t)
+			engine, _ := sim.walk(t, Ripple{}, Twist{Velocity: geometry.Vector{X: 60}})
+
+			// a height the gait can't walk at is refused up front, one it can is
+			// reached without the gait stopping
+			from := sim.hexapod.GetStance()
+			err := sim.hexapod.SetBodyHeight(height, 500*time.Millisecond)
+			sim.run(3 * time.Second)
+			checkWalking(t, engine)
+
+			want := height
+			if err != nil {
+				want = from.Height
+			}
+
+			if got := sim.hexapod.GetStance().Height; math.Abs(got-want) > 1e-6 {
+				t.Errorf("height = %.2fmm, want %.2fmm (SetBodyHeight returned %v)", got, want, err)
+			}
+		})
+	}
+}
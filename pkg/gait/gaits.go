@@ -0,0 +1,96 @@
+package gait
+
+// Gait is a stepping pattern: where in the cycle each leg lifts, and how long every
+// foot has to stay down so that too many legs are never up at once
+type Gait interface {
+	Name() string
+
+	// PhaseOffsets returns each leg's starting point in the cycle (0 to 1), indexed
+	// like hexapod.DefaultLayout; a leg lifts once its phase reaches the duty factor,
+	// so the legs step in order of decreasing offset
+	PhaseOffsets() []float64
+
+	// MinDutyFactor is the smallest duty factor the pattern is stable at
+	MinDutyFactor() float64
+}
+
+// Tripod is the fastest gait: (RightLeg1, LeftLeg2, RightLeg3) step together, then
+// (LeftLeg1, RightLeg2, LeftLeg3), so three feet are always down
+type Tripod struct{}
+
+func (Tripod) Name() string {
+	return "tripod"
+}
+
+func (Tripod) PhaseOffsets() []float64 {
+	return []float64{
+		RightLeg1: 0,
+		RightLeg2: 0.5,
+		RightLeg3: 0,
+		LeftLeg1:  0.5,
+		LeftLeg2:  0,
+		LeftLeg3:  0.5,
+	}
+}
+
+func (Tripod) MinDutyFactor() float64 {
+	return 0.5
+}
+
+// Wave is the slowest and most stable gait: one leg steps at a time, working from
+// back to front up the right side and then the left, so five feet are always down
+type Wave struct{}
+
+func (Wave) Name() string {
+	return "wave"
+}
+
+func (Wave) PhaseOffsets() []float64 {
+	return []float64{
+		RightLeg3: 0,
+		RightLeg2: 5.0 / 6,
+		RightLeg1: 4.0 / 6,
+		LeftLeg3:  3.0 / 6,
+		LeftLeg2:  2.0 / 6,
+		LeftLeg1:  1.0 / 6,
+	}
+}
+
+func (Wave) MinDutyFactor() float64 {
+	return 5.0 / 6
+}
+
+// Ripple runs a back to front wave down each side, with the two sides half a cycle
+// apart, so no more than two legs (never neighbours) are up at once
+type Ripple struct{}
+
+func (Ripple) Name() string {
+	return "ripple"
+}
+
+func (Ripple) PhaseOffsets() []float64 {
+	return []float64{
+		RightLeg3: 0,
+		RightLeg2: 2.0 / 3,
+		RightLeg1: 1.0 / 3,
+		LeftLeg3:  1.0 / 2,
+		LeftLeg2:  1.0 / 6,
+		LeftLeg1:  5.0 / 6,
+	}
+}
+
+func (Ripple) MinDutyFactor() float64 {
+	return 2.0 / 3
+}
+
+var byName = map[string]Gait{
+	"tripod": Tripod{},
+	"wave":   Wave{},
+	"ripple": Ripple{},
+}
+
+// Lookup finds a gait by its name (ie - "ripple")
+func Lookup(name string) (Gait, bool) {
+	gait, ok := byName[name]
+	return gait, ok
+}
@@ -0,0 +1,120 @@
+package gait
+
+import (
+	"math"
+	"time"
+
+	"github.com/carldanley/hexapod/pkg/hexapod"
+)
+
+// DefaultTransitionCycles is how many cycles a transition is spread over by default
+const DefaultTransitionCycles = 2
+
+// transition blends the phase offsets and options of one gait into another
+type transition struct {
+	gait        Gait
+	from        Options
+	to          Options
+	fromOffsets []float64
+	toOffsets   []float64
+	start       float64
+	cycles      float64
+}
+
+// Transition switches to another gait (or the same gait with new options) without
+// stopping, blending the legs' timing and the stride over the given number of cycles
+// (or DefaultTransitionCycles if 0); legs are still only allowed to lift when the
+// rest leave the robot stable
+func (e *Engine) Transition(gait Gait, options *Options, cycles float64) error {
+	to, err := gaitOptions(gait, options)
+	if err != nil {
+		return err
+	}
+
+	if cycles <= 0 {
+		cycles = DefaultTransitionCycles
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// nothing to blend while standing still
+	if !e.running {
+		e.gait = gait
+		e.options = to
+		e.offsets = gait.PhaseOffsets()
+		e.transition = nil
+
+		return nil
+	}
+
+	// stances have to leave room for the bigger of the two steps
+	e.hexapod.TakeLegs(e, hexapod.Footwork{
+		StepHeight:   math.Max(e.options.StepHeight, to.StepHeight),
+		StrideLength: math.Max(e.options.StrideLength, to.StrideLength),
+	})
+
+	// a transition already under way carries on from wherever it got to
+	e.transition = &transition{
+		gait:        gait,
+		from:        e.options,
+		to:          to,
+		fromOffsets: append([]float64{}, e.offsets...),
+		toOffsets:   gait.PhaseOffsets(),
+		start:       e.cycles,
+		cycles:      cycles,
+	}
+
+	return nil
+}
+
+// SetOptions changes the stride (keeping the current gait), blending over
+// DefaultTransitionCycles
+func (e *Engine) SetOptions(options Options) error {
+	return e.Transition(e.GetGait(), &options, DefaultTransitionCycles)
+}
+
+func (e *Engine) IsTransitioning() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.transition != nil
+}
+
+// updateTransition moves the offsets and options along the transition
+func (e *Engine) updateTransition() {
+	t := e.transition
+	if t == nil {
+		return
+	}
+
+	progress := (e.cycles - t.start) / t.cycles
+	if progress >= 1 {
+		e.gait = t.gait
+		e.options = t.to
+		e.offsets = append([]float64{}, t.toOffsets...)
+		e.transition = nil
+
+		return
+	}
+
+	for i := range e.offsets {
+		// go the short way round the cycle
+		change := t.toOffsets[i] - t.fromOffsets[i]
+		change -= math.Round(change)
+
+		e.offsets[i] = t.fromOffsets[i] + change*progress
+	}
+
+	lerp := func(from, to float64) float64 {
+		return from + (to-from)*progress
+	}
+
+	e.options = Options{
+		StrideLength:       lerp(t.from.StrideLength, t.to.StrideLength),
+		StepHeight:         lerp(t.from.StepHeight, t.to.StepHeight),
+		CycleTime:          time.Duration(lerp(float64(t.from.CycleTime), float64(t.to.CycleTime))),
+		DutyFactor:         lerp(t.from.DutyFactor, t.to.DutyFactor),
+		MinStabilityMargin: math.Max(t.from.MinStabilityMargin, t.to.MinStabilityMargin),
+	}
+}
@@ -0,0 +1,265 @@
+package gait
+
+import (
+	"math"
+	"time"
+
+	"github.com/carldanley/hexapod/pkg/geometry"
+	"github.com/carldanley/hexapod/pkg/legs"
+)
+
+// how many points along each foot's stance and swing are checked for reachability
+const twistCheckPoints = 32
+
+// how many halvings are spent searching for the fastest reachable twist
+const twistSearchSteps = 12
+
+// Twist is how the body should move: Velocity (in millimetres per second, x forward
+// and y left) and YawRate (in degrees per second, anticlockwise from above), so the
+// robot can walk straight, crab, turn on the spot or arc
+type Twist struct {
+	Velocity geometry.Vector `json:"velocity"`
+	YawRate  float64         `json:"yawRate"`
+}
+
+func (t Twist) IsZero() bool {
+	return (t.Velocity.X == 0) && (t.Velocity.Y == 0) && (t.YawRate == 0)
+}
+
+func (t Twist) Scale(factor float64) Twist {
+	return Twist{
+		Velocity: t.Velocity.Scale(factor),
+		YawRate:  t.YawRate * factor,
+	}
+}
+
+func (t Twist) lerp(to Twist, progress float64) Twist {
+	return Twist{
+		Velocity: t.Velocity.Add(to.Velocity.Sub(t.Velocity).Scale(progress)),
+		YawRate:  t.YawRate + (to.YawRate-t.YawRate)*progress,
+	}
+}
+
+// move returns where a point fixed to the body ends up after seconds (which may be
+// negative, to see where a point fixed to the ground goes in the body frame)
+func (t Twist) move(point geometry.Vector, seconds float64) geometry.Vector {
+	moved := point.RotateZ(t.YawRate * seconds).Add(t.Velocity.Scale(seconds))
+	moved.Z = point.Z
+
+	return moved
+}
+
+// footSpeed returns how fast a body point at the given position moves over the ground
+func (t Twist) footSpeed(point geometry.Vector) float64 {
+	yawRate := geometry.Radians(t.YawRate)
+	return math.Hypot(t.Velocity.X-yawRate*point.Y, t.Velocity.Y+yawRate*point.X)
+}
+
+// SetTwist sets how the body should move, returning the twist that will actually be
+// used: it's scaled down (keeping its direction and centre of rotation) until every
+// foot's stride fits in StrideLength and every leg can reach its whole step. The
+// robot speeds up or slows down to it over a cycle.
+func (e *Engine) SetTwist(twist Twist) Twist {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	twist.Velocity.Z = 0
+
+	// part way through a transition the twist has to suit both ends of it
+	twist = e.limitTwist(twist, e.options)
+	if e.transition != nil {
+		twist = e.limitTwist(twist, e.transition.to)
+	}
+
+	if !e.stopping {
+		e.targetTwist = twist
+	}
+
+	return twist
+}
+
+// SetVelocity walks without turning (see SetTwist)
+func (e *Engine) SetVelocity(velocity geometry.Vector) geometry.Vector {
+	return e.SetTwist(Twist{Velocity: velocity}).Velocity
+}
+
+// GetTwist returns how the body is moving right now
+func (e *Engine) GetTwist() Twist {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.twist
+}
+
+// GetVelocity returns the velocity the body is moving at right now
+func (e *Engine) GetVelocity() geometry.Vector {
+	return e.GetTwist().Velocity
+}
+
+// limitTwist scales the twist down to fit the stride length and then the legs'
+// reach
+func (e *Engine) limitTwist(twist Twist, options Options) Twist {
+	twist = e.capStride(twist, options)
+	if e.isReachable(twist, options) {
+		return twist
+	}
+
+	lowest, highest := 0.0, 1.0
+	for i := 0; i < twistSearchSteps; i++ {
+		middle := (lowest + highest) / 2
+		if e.isReachable(twist.Scale(middle), options) {
+			lowest = middle
+		} else {
+			highest = middle
+		}
+	}
+
+	return twist.Scale(lowest)
+}
+
+// capStride scales the twist down so no foot travels further than the stride length
+// while it's on the ground
+func (e *Engine) capStride(twist Twist, options Options) Twist {
+	maxSpeed := options.StrideLength / stanceTime(options).Seconds()
+
+	fastest := 0.0
+	for _, foot := range e.feet {
+		fastest = math.Max(fastest, twist.footSpeed(foot.neutral))
+	}
+
+	if fastest > maxSpeed {
+		return twist.Scale(maxSpeed / fastest)
+	}
+
+	return twist
+}
+
+// isReachable checks every leg can follow its whole stance and swing for the twist,
+// including the extra slide of a foot that lifts late
+func (e *Engine) isReachable(twist Twist, options Options) bool {
+	halfStance := stanceTime(options).Seconds() / 2
+	late := e.lateness().Seconds()
+
+	for i, foot := range e.feet {
+		leg := e.hexapod.GetLeg(i)
+
+		// on the ground, from landing to liftoff
+		for j := 0; j <= twistCheckPoints; j++ {
+			progress := float64(j) / twistCheckPoints
+			if !leg.IsReachable(twist.move(foot.neutral, halfStance-(2*halfStance+late)*progress)) {
+				return false
+			}
+		}
+
+		// and back through the air
+		step := legs.Step{
+			From:   twist.move(foot.neutral, -(halfStance + late)),
+			To:     twist.move(foot.neutral, halfStance),
+			Height: options.StepHeight,
+		}
+
+		if !canStep(leg, step) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// canStep checks a leg can reach every point of a step
+func canStep(leg legs.Leg, step legs.Step) bool {
+	for i := 0; i <= twistCheckPoints; i++ {
+		if !leg.IsReachable(step.PointAt(float64(i) / twistCheckPoints)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// keepFeetInReach slows the body for this tick so every foot on the ground stays in
+// reach and, going on at this twist, lifts off somewhere it can still step from (see
+// landing). The twist is limited to what the legs reach walking steadily, but a foot
+// that lands while the body is still speeding up, or that's held down for balance,
+// slides further than that before it lifts.
+func (e *Engine) keepFeetInReach(elapsed time.Duration) {
+	late := e.lateness().Seconds()
+
+	fits := func(index int, twist Twist) bool {
+		leg := e.hexapod.GetLeg(index)
+		position := e.feet[index].position
+		if !leg.IsReachable(twist.move(position, -elapsed.Seconds())) {
+			return false
+		}
+
+		// it might not lift until the tick after its stance is over
+		left := math.Max(0, e.options.DutyFactor-e.legPhase(index))*e.options.CycleTime.Seconds() + late
+		liftoff := twist.move(position, -(elapsed.Seconds() + left))
+
+		return e.canLand(index, liftoff, twist, 1) || e.canLand(index, liftoff, twist, 0)
+	}
+
+	// stopping doesn't help a foot that already can't step from where it is (ie - one
+	// that's only just landed); it's better off carrying on towards where it lifts
+	guarded := []int{}
+	for i, foot := range e.feet {
+		if !foot.swinging && fits(i, Twist{}) {
+			guarded = append(guarded, i)
+		}
+	}
+
+	allFit := func(twist Twist) bool {
+		for _, i := range guarded {
+			if !fits(i, twist) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	if allFit(e.twist) {
+		return
+	}
+
+	lowest, highest := 0.0, 1.0
+	for i := 0; i < twistSearchSteps; i++ {
+		middle := (lowest + highest) / 2
+		if allFit(e.twist.Scale(middle)) {
+			lowest = middle
+		} else {
+			highest = middle
+		}
+	}
+
+	e.twist = e.twist.Scale(lowest)
+}
+
+// updateTwist eases the twist towards the target, taking a cycle to go from standing
+// still to full speed
+func (e *Engine) updateTwist(elapsed time.Duration) {
+	target := e.capStride(e.targetTwist, e.options)
+
+	// measure the change by how much it changes the fastest foot's speed
+	change := 0.0
+	difference := Twist{
+		Velocity: target.Velocity.Sub(e.twist.Velocity),
+		YawRate:  target.YawRate - e.twist.YawRate,
+	}
+
+	for _, foot := range e.feet {
+		change = math.Max(change, difference.footSpeed(foot.neutral))
+	}
+
+	maxSpeed := e.options.StrideLength / e.stanceTime().Seconds()
+	maxChange := maxSpeed * elapsed.Seconds() / e.options.CycleTime.Seconds()
+
+	if change > maxChange {
+		e.twist = e.twist.lerp(target, maxChange/change)
+	} else {
+		e.twist = target
+	}
+
+	// a shrinking stride (ie - part way through a transition) caps the speed straight away
+	e.twist = e.capStride(e.twist, e.options)
+}
@@ -0,0 +1,97 @@
+package geometry
+
+import (
+	"fmt"
+	"math"
+)
+
+// Vector is a point or direction in millimetres; the body frame has x pointing
+// forward, y pointing left and z pointing up
+type Vector struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+func (v Vector) String() string {
+	return fmt.Sprintf("(%.2f, %.2f, %.2f)", v.X, v.Y, v.Z)
+}
+
+func (v Vector) Add(other Vector) Vector {
+	return Vector{v.X + other.X, v.Y + other.Y, v.Z + other.Z}
+}
+
+func (v Vector) Sub(other Vector) Vector {
+	return Vector{v.X - other.X, v.Y - other.Y, v.Z - other.Z}
+}
+
+func (v Vector) Scale(factor float64) Vector {
+	return Vector{v.X * factor, v.Y * factor, v.Z * factor}
+}
+
+func (v Vector) Dot(other Vector) float64 {
+	return v.X*other.X + v.Y*other.Y + v.Z*other.Z
+}
+
+func (v Vector) Length() float64 {
+	return math.Sqrt(v.Dot(v))
+}
+
+// RotateZ turns the vector about the z axis by angle degrees (anticlockwise when
+// looking down on the body)
+func (v Vector) RotateZ(angle float64) Vector {
+	sin, cos := math.Sincos(Radians(angle))
+
+	return Vector{
+		X: v.X*cos - v.Y*sin,
+		Y: v.X*sin + v.Y*cos,
+		Z: v.Z,
+	}
+}
+
+// RotateX turns the vector about the x axis by angle degrees (rolling to the right
+// when looking forward)
+func (v Vector) RotateX(angle float64) Vector {
+	sin, cos := math.Sincos(Radians(angle))
+
+	return Vector{
+		X: v.X,
+		Y: v.Y*cos - v.Z*sin,
+		Z: v.Y*sin + v.Z*cos,
+	}
+}
+
+// RotateY turns the vector about the y axis by angle degrees (pitching nose down)
+func (v Vector) RotateY(angle float64) Vector {
+	sin, cos := math.Sincos(Radians(angle))
+
+	return Vector{
+		X: v.X*cos + v.Z*sin,
+		Y: v.Y,
+		Z: -v.X*sin + v.Z*cos,
+	}
+}
+
+// Orientation is a roll, pitch and yaw in degrees, applied in that order
+type Orientation struct {
+	Roll  float64 `json:"roll"`
+	Pitch float64 `json:"pitch"`
+	Yaw   float64 `json:"yaw"`
+}
+
+func (o Orientation) Rotate(v Vector) Vector {
+	return v.RotateX(o.Roll).RotateY(o.Pitch).RotateZ(o.Yaw)
+}
+
+// Unrotate undoes Rotate
+func (o Orientation) Unrotate(v Vector) Vector {
+	return v.RotateZ(-o.Yaw).RotateY(-o.Pitch).RotateX(-o.Roll)
+}
+
+func Radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+func Degrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
@@ -0,0 +1,80 @@
+package geometry
+
+import (
+	"math"
+	"sort"
+)
+
+// ConvexHull returns the convex hull of the points as seen from above (z is ignored),
+// anticlockwise; fewer than three points (or points all in a line) have no area and
+// give back whatever is left of the hull's outline
+func ConvexHull(points []Vector) []Vector {
+	sorted := append([]Vector{}, points...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].X != sorted[j].X {
+			return sorted[i].X < sorted[j].X
+		}
+
+		return sorted[i].Y < sorted[j].Y
+	})
+
+	if len(sorted) < 3 {
+		return sorted
+	}
+
+	// andrew's monotone chain: build the lower hull then the upper hull
+	hull := []Vector{}
+	for _, pass := range [][]Vector{sorted, reversed(sorted)} {
+		start := len(hull)
+		for _, point := range pass {
+			for (len(hull) >= start+2) && (cross(hull[len(hull)-2], hull[len(hull)-1], point) <= 0) {
+				hull = hull[:len(hull)-1]
+			}
+
+			hull = append(hull, point)
+		}
+
+		// the last point of each pass starts the next one
+		hull = hull[:len(hull)-1]
+	}
+
+	return hull
+}
+
+// PolygonMargin returns how far (in the xy plane) the point is inside a convex,
+// anticlockwise polygon (ie - from ConvexHull), measured to the nearest edge; it's
+// negative when the point is outside, and negative infinity for a polygon with no area
+func PolygonMargin(polygon []Vector, point Vector) float64 {
+	if len(polygon) < 3 {
+		return math.Inf(-1)
+	}
+
+	margin := math.Inf(1)
+	for i, from := range polygon {
+		to := polygon[(i+1)%len(polygon)]
+
+		length := math.Hypot(to.X-from.X, to.Y-from.Y)
+		if length == 0 {
+			continue
+		}
+
+		// signed distance to the edge's line, positive on the inside (left) of it
+		margin = math.Min(margin, cross(from, to, point)/length)
+	}
+
+	return margin
+}
+
+// cross is the z component of (b - a) x (c - a), positive when a, b, c turn anticlockwise
+func cross(a, b, c Vector) float64 {
+	return (b.X-a.X)*(c.Y-a.Y) - (b.Y-a.Y)*(c.X-a.X)
+}
+
+func reversed(points []Vector) []Vector {
+	result := make([]Vector, 0, len(points))
+	for i := len(points) - 1; i >= 0; i-- {
+		result = append(result, points[i])
+	}
+
+	return result
+}
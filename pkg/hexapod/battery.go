@@ -0,0 +1,268 @@
+package hexapod
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// VoltageSensor measures the battery voltage (ie - an INA219's bus voltage)
+type VoltageSensor interface {
+	GetBusVoltage() (float32, error)
+}
+
+type PowerState int
+
+const (
+	PowerUnknown PowerState = iota
+	PowerNormal
+	PowerWarning
+	PowerCritical
+)
+
+func (ps PowerState) String() string {
+	switch ps {
+	case PowerUnknown:
+		return "unknown"
+	case PowerNormal:
+		return "normal"
+	case PowerWarning:
+		return "warning"
+	case PowerCritical:
+		return "critical"
+	}
+
+	return fmt.Sprintf("PowerState(%d)", int(ps))
+}
+
+func (ps PowerState) MarshalText() ([]byte, error) {
+	return []byte(ps.String()), nil
+}
+
+type BatteryOptions struct {
+	// how often the voltage is read, and how many readings are averaged (servos
+	// pulling hard will make the voltage sag for a moment); the level isn't judged
+	// until that many readings have been taken
+	Interval time.Duration
+	Samples  int
+
+	// voltages (in volts) at which the warning and critical levels kick in; the
+	// voltage has to climb Hysteresis above the warning level to count as normal again
+	WarningVoltage  float32
+	CriticalVoltage float32
+	Hysteresis      float32
+
+	// how long the sit down takes when the battery goes critical
+	SitDownDuration time.Duration
+
+	// called (from a goroutine of their own, so they're free to call Shutdown) when
+	// the level is reached
+	OnWarning  func(voltage float32)
+	OnCritical func(voltage float32)
+}
+
+// DefaultBatteryOptions suit a 2S lipo
+var DefaultBatteryOptions = BatteryOptions{
+	Interval:        500 * time.Millisecond,
+	Samples:         8,
+	WarningVoltage:  7.0,
+	CriticalVoltage: 6.6,
+	Hysteresis:      0.2,
+	SitDownDuration: 2 * time.Second,
+}
+
+type batteryMonitor struct {
+	mutex           sync.Mutex
+	sensor          VoltageSensor
+	options         BatteryOptions
+	samples         []float32
+	voltage         float32
+	state           PowerState
+	stopWorkChannel chan bool
+	doneChannel     chan bool
+}
+
+// MonitorBattery starts watching the battery voltage; when it goes critical the
+// hexapod sits down and shuts itself down rather than collapsing
+func (hp *Hexapod) MonitorBattery(sensor VoltageSensor, options *BatteryOptions) error {
+	opts := DefaultBatteryOptions
+	if options != nil {
+		opts = *options
+	}
+
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultBatteryOptions.Interval
+	}
+
+	if opts.Samples <= 0 {
+		opts.Samples = 1
+	}
+
+	if opts.CriticalVoltage >= opts.WarningVoltage {
+		return fmt.Errorf("critical voltage (%f) must be below warning voltage (%f)", opts.CriticalVoltage, opts.WarningVoltage)
+	}
+
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	if hp.battery != nil {
+		return fmt.Errorf("battery is already being monitored")
+	}
+
+	hp.battery = &batteryMonitor{
+		sensor:          sensor,
+		options:         opts,
+		samples:         []float32{},
+		state:           PowerUnknown,
+		stopWorkChannel: make(chan bool),
+		doneChannel:     make(chan bool),
+	}
+
+	go hp.monitorBattery(hp.battery)
+
+	return nil
+}
+
+func (hp *Hexapod) GetPowerState() PowerState {
+	battery := hp.getBattery()
+	if battery == nil {
+		return PowerUnknown
+	}
+
+	battery.mutex.Lock()
+	defer battery.mutex.Unlock()
+
+	return battery.state
+}
+
+func (hp *Hexapod) GetBatteryVoltage() float32 {
+	battery := hp.getBattery()
+	if battery == nil {
+		return 0
+	}
+
+	battery.mutex.Lock()
+	defer battery.mutex.Unlock()
+
+	return battery.voltage
+}
+
+func (hp *Hexapod) getBattery() *batteryMonitor {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	return hp.battery
+}
+
+func (hp *Hexapod) stopBatteryMonitor() {
+	hp.mutex.Lock()
+	battery := hp.battery
+	hp.mutex.Unlock()
+
+	if battery == nil {
+		return
+	}
+
+	battery.mutex.Lock()
+	stopWorkChannel := battery.stopWorkChannel
+	battery.stopWorkChannel = nil
+	battery.mutex.Unlock()
+
+	if stopWorkChannel != nil {
+		close(stopWorkChannel)
+	}
+
+	<-battery.doneChannel
+}
+
+func (hp *Hexapod) monitorBattery(battery *batteryMonitor) {
+	defer close(battery.doneChannel)
+
+	ticker := time.NewTicker(battery.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-battery.stopWorkChannel:
+			return
+		case <-ticker.C:
+			voltage, err := battery.sensor.GetBusVoltage()
+			if err != nil {
+				// a failed read just gets tried again on the next tick
+				continue
+			}
+
+			state, changed := battery.record(voltage)
+			if !changed {
+				continue
+			}
+
+			// the callbacks can't run here, since shutting down waits on this goroutine
+			if (state == PowerWarning) && (battery.options.OnWarning != nil) {
+				go battery.options.OnWarning(battery.getVoltage())
+			}
+
+			if state == PowerCritical {
+				if battery.options.OnCritical != nil {
+					go battery.options.OnCritical(battery.getVoltage())
+				}
+
+				// get the body down while there's still enough power to do it gently, then
+				// shut down (from another goroutine, since shutting down waits on this one)
+				hp.SitDown(battery.options.SitDownDuration)
+				go hp.Shutdown()
+
+				return
+			}
+		}
+	}
+}
+
+// record adds a reading to the moving average, returning the (possibly new) state;
+// the state stays unknown until the average covers a full set of samples
+func (bm *batteryMonitor) record(voltage float32) (PowerState, bool) {
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+
+	bm.samples = append(bm.samples, voltage)
+	if len(bm.samples) > bm.options.Samples {
+		bm.samples = bm.samples[1:]
+	}
+
+	total := float32(0)
+	for _, sample := range bm.samples {
+		total += sample
+	}
+
+	bm.voltage = total / float32(len(bm.samples))
+
+	// a single sag (ie - at power up) mustn't be enough to sit the robot down
+	if len(bm.samples) < bm.options.Samples {
+		return bm.state, false
+	}
+
+	state := bm.state
+	switch {
+	case bm.voltage <= bm.options.CriticalVoltage:
+		state = PowerCritical
+	case bm.voltage <= bm.options.WarningVoltage:
+		// once critical there's no going back
+		if state != PowerCritical {
+			state = PowerWarning
+		}
+	case (state == PowerUnknown) || (bm.voltage > bm.options.WarningVoltage+bm.options.Hysteresis):
+		state = PowerNormal
+	}
+
+	changed := state != bm.state
+	bm.state = state
+
+	return state, changed
+}
+
+func (bm *batteryMonitor) getVoltage() float32 {
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+
+	return bm.voltage
+}
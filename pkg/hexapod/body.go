@@ -0,0 +1,180 @@
+package hexapod
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/carldanley/hexapod/pkg/easings"
+	"github.com/carldanley/hexapod/pkg/geometry"
+	"github.com/carldanley/hexapod/pkg/legs"
+)
+
+// how many poses along the way are checked before the body starts moving
+const bodyPoseCheckPoints = 16
+
+// BodyPoseEasing sets the pace of body moves
+var BodyPoseEasing easings.Func = easings.SineInOut
+
+// BodyPose is where the body is relative to where it was when the feet were put down
+// (ie - after Startup); the translation is in millimetres and the angles in degrees
+type BodyPose struct {
+	Translation geometry.Vector      `json:"translation"`
+	Orientation geometry.Orientation `json:"orientation"`
+}
+
+// BodyToWorld converts a point in the body frame to the frame the feet stand in
+func (bp BodyPose) BodyToWorld(point geometry.Vector) geometry.Vector {
+	return bp.Orientation.Rotate(point).Add(bp.Translation)
+}
+
+// WorldToBody undoes BodyToWorld
+func (bp BodyPose) WorldToBody(point geometry.Vector) geometry.Vector {
+	return bp.Orientation.Unrotate(point.Sub(bp.Translation))
+}
+
+func (bp BodyPose) blend(target BodyPose, progress float64) BodyPose {
+	lerp := func(from, to float64) float64 {
+		return from + (to-from)*progress
+	}
+
+	return BodyPose{
+		Translation: bp.Translation.Add(target.Translation.Sub(bp.Translation).Scale(progress)),
+		Orientation: geometry.Orientation{
+			Roll:  lerp(bp.Orientation.Roll, target.Orientation.Roll),
+			Pitch: lerp(bp.Orientation.Pitch, target.Orientation.Pitch),
+			Yaw:   lerp(bp.Orientation.Yaw, target.Orientation.Yaw),
+		},
+	}
+}
+
+// bodyPoseTask moves the body on every scheduler tick, re-solving every leg so the
+// feet stay where they are on the ground
+type bodyPoseTask struct {
+	hexapod   *Hexapod
+	from      BodyPose
+	to        BodyPose
+	feet      []geometry.Vector
+	duration  time.Duration
+	startTime time.Time
+}
+
+// SetBodyPose moves the body to the given translation and rotation (in degrees) over
+// duration, keeping every foot planted where it is (any trajectory or stance move is
+// stopped first, leaving the feet where they got to); every pose along the way is
+// checked first, so nothing moves if a leg can't reach (see legs.UnreachableError
+// and legs.JointLimitError). It returns ErrLegsInUse while a leg controller (ie - a
+// gait) is placing the feet.
+func (hp *Hexapod) SetBodyPose(translation geometry.Vector, roll, pitch, yaw float64, duration time.Duration) error {
+	target := BodyPose{
+		Translation: translation,
+		Orientation: geometry.Orientation{Roll: roll, Pitch: pitch, Yaw: yaw},
+	}
+
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	if hp.legController != nil {
+		return ErrLegsInUse
+	}
+
+	// the feet stay wherever the legs are heading for now (including any trajectory's
+	// last step)
+	hp.cancelPaths()
+	from := hp.bodyPose
+	feet := []geometry.Vector{}
+	for _, leg := range hp.legs {
+		angles := leg.GetTargetAngles()
+		_, foot := leg.ForwardKinematics(angles.Coxa, angles.Femur, angles.Tibia)
+		feet = append(feet, from.BodyToWorld(foot))
+	}
+
+	for i := 0; i <= bodyPoseCheckPoints; i++ {
+		pose := from.blend(target, float64(i)/bodyPoseCheckPoints)
+		if _, err := hp.solveFeet(pose, feet); err != nil {
+			return err
+		}
+	}
+
+	task := &bodyPoseTask{
+		hexapod:  hp,
+		from:     from,
+		to:       target,
+		feet:     feet,
+		duration: duration,
+	}
+
+	// a new pose takes over from wherever the last one (or a stance move) got to
+	hp.endStance(ErrStanceReplaced)
+	hp.bodyPoseTask = task
+	hp.scheduler.AddTask(task)
+
+	return nil
+}
+
+func (hp *Hexapod) GetBodyPose() BodyPose {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	return hp.bodyPose
+}
+
+// solveFeet works out every leg's joint angles for the feet (in the world frame) with
+// the body at the given pose
+func (hp *Hexapod) solveFeet(pose BodyPose, feet []geometry.Vector) ([]legs.JointAngles, error) {
+	solutions := []legs.JointAngles{}
+	for i, leg := range hp.legs {
+		angles, err := leg.InverseKinematics(pose.WorldToBody(feet[i]))
+		if err != nil {
+			return nil, fmt.Errorf("leg %d: %w", i, err)
+		}
+
+		solutions = append(solutions, angles)
+	}
+
+	return solutions, nil
+}
+
+// Tick only ever runs on the scheduler's goroutine
+func (bpt *bodyPoseTask) Tick(now time.Time) bool {
+	if bpt.startTime.IsZero() {
+		bpt.startTime = now
+	}
+
+	elapsed := now.Sub(bpt.startTime)
+	progress := float32(1)
+	if elapsed < bpt.duration {
+		progress = BodyPoseEasing(float32(elapsed.Seconds()), 0, 1, float32(bpt.duration.Seconds()))
+	}
+
+	hp := bpt.hexapod
+	pose := bpt.from.blend(bpt.to, float64(progress))
+
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	// a newer pose has taken over
+	if hp.bodyPoseTask != bpt {
+		return false
+	}
+
+	solutions, err := hp.solveFeet(pose, bpt.feet)
+	if err != nil {
+		// every pose was checked up front, so only an overshooting easing gets here;
+		// leave the body where it got to
+		hp.bodyPoseTask = nil
+		return false
+	}
+
+	for i, leg := range hp.legs {
+		leg.SetJointAnglesAt(solutions[i], now)
+	}
+
+	hp.bodyPose = pose
+
+	if elapsed >= bpt.duration {
+		hp.bodyPoseTask = nil
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,148 @@
+package hexapod
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/carldanley/hexapod/pkg/geometry"
+	"github.com/carldanley/hexapod/pkg/legs"
+)
+
+// ErrLegsInUse is returned when something tries to move the feet while a leg
+// controller (ie - a gait) is driving them
+var ErrLegsInUse = errors.New("the legs are being driven by a leg controller")
+
+// Footwork is how far a leg controller moves the feet from their neutral positions,
+// which stance changes have to leave room for
+type Footwork struct {
+	// how high (in millimetres) the feet are lifted
+	StepHeight float64
+
+	// how far (in millimetres) a foot travels along the ground in a step, centred on
+	// its neutral position and in any direction
+	StrideLength float64
+
+	// how far and which way (in the body frame) each foot is travelling along the
+	// ground in a step right now, from where it lands to where it lifts off; empty
+	// until the controller gets moving (see UpdateStrides)
+	Strides []geometry.Vector
+}
+
+// LegController is something that places the feet on every scheduler tick (ie - a
+// gait engine). Only one can hold the legs at a time, and anything that moves the
+// legs by joint angle (SitDown, MoveAllLegsToAngles, Attach, Detach, Startup and
+// Shutdown) halts it first, along with any trajectory (see FollowPath).
+type LegController interface {
+	// Halt stops placing the feet straight away, leaving them wherever they are. The
+	// hexapod has already let go of the controller, and never holds its own mutex
+	// while calling Halt.
+	Halt()
+}
+
+// TakeLegs hands the legs over to controller, halting whichever controller had them
+// and cancelling any body pose move or trajectory. Stance changes have to leave the
+// feet room for the controller's footwork; calling it again with the same controller
+// just updates the footwork. A stance that's only been estimated is fixed where it is,
+// since the estimate can't be trusted once the feet start stepping.
+func (hp *Hexapod) TakeLegs(controller LegController, footwork Footwork) {
+	hp.mutex.Lock()
+	previous := hp.legController
+	hp.legController = controller
+	hp.footwork = footwork
+	hp.bodyPoseTask = nil
+	hp.cancelPaths()
+
+	if !hp.stanceKnown {
+		hp.stance = hp.currentStance()
+		hp.stanceKnown = true
+	}
+	hp.mutex.Unlock()
+
+	if (previous != nil) && (previous != controller) {
+		previous.Halt()
+	}
+}
+
+// ReleaseLegs lets go of the legs, if controller still holds them
+func (hp *Hexapod) ReleaseLegs(controller LegController) {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	if hp.legController != controller {
+		return
+	}
+
+	hp.legController = nil
+	hp.footwork = Footwork{}
+}
+
+// UpdateStrides records the strides the feet are taking right now (see
+// Footwork.Strides), if controller still holds the legs
+func (hp *Hexapod) UpdateStrides(controller LegController, strides []geometry.Vector) {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	if hp.legController == controller {
+		hp.footwork.Strides = strides
+	}
+}
+
+// GetLegController returns whatever is driving the legs, or nil
+func (hp *Hexapod) GetLegController() LegController {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	return hp.legController
+}
+
+// FollowPath moves a leg's foot along the path (see legs.Leg.FollowPath), taking over
+// from any body pose or stance move; it's refused while a leg controller holds the
+// legs
+func (hp *Hexapod) FollowPath(index int, path legs.Path, duration time.Duration, easingName string) (*legs.Trajectory, error) {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	if (index < 0) || (index >= len(hp.legs)) {
+		return nil, fmt.Errorf("leg %d is out of range", index)
+	}
+
+	if hp.legController != nil {
+		return nil, ErrLegsInUse
+	}
+
+	hp.bodyPoseTask = nil
+	hp.endStance(ErrStanceReplaced)
+
+	return hp.legs[index].FollowPath(hp.scheduler, path, duration, easingName)
+}
+
+// cancelPaths stops every trajectory, so something else can place the feet
+func (hp *Hexapod) cancelPaths() {
+	for _, leg := range hp.legs {
+		leg.CancelPath()
+	}
+}
+
+// reclaimLegs takes the legs back before moving them by joint angle, halting the leg
+// controller along with any body pose or stance move; the stance is estimated from
+// wherever the feet end up afterwards, and every leg is assumed to hold the body up
+func (hp *Hexapod) reclaimLegs() {
+	hp.mutex.Lock()
+	controller := hp.legController
+	hp.legController = nil
+	hp.footwork = Footwork{}
+	hp.bodyPoseTask = nil
+	hp.endStance(ErrStanceReplaced)
+	hp.stanceKnown = false
+	hp.cancelPaths()
+	hp.mutex.Unlock()
+
+	if controller != nil {
+		controller.Halt()
+	}
+
+	for _, leg := range hp.legs {
+		leg.SetHoldingLoad(1)
+	}
+}
@@ -1,46 +1,150 @@
 package hexapod
 
 import (
-	"log"
+	"sync"
 	"time"
 
 	"github.com/carldanley/hexapod/pkg/i2c"
 	"github.com/carldanley/hexapod/pkg/legs"
 	"github.com/carldanley/hexapod/pkg/pca9685"
 	"github.com/carldanley/hexapod/pkg/servos"
+	"github.com/carldanley/hexapod/pkg/simulator"
 )
 
+const DefaultDevice = "/dev/i2c-1"
+
 type Hexapod struct {
+	mutex        sync.Mutex
+	shutdownOnce sync.Once
 	legs         []legs.Leg
 	i2cSlaves    []*i2c.Options
-	servoDrivers []*pca9685.PCA9685
+	servoDrivers []servoDriver
+	scheduler    *servos.Scheduler
+	battery      *batteryMonitor
+	thermal      *thermalMonitor
+	bodyPose     BodyPose
+	bodyPoseTask *bodyPoseTask
+	massModel    MassModel
+	stance       Stance
+	stanceKnown  bool
+	stanceTask   *stanceTask
+
+	// whatever is placing the feet (ie - a gait) and how far it moves them
+	legController LegController
+	footwork      Footwork
+
+	// where the calibration was read from, empty when the built in one is used
+	calibrationPath string
+}
+
+type Options struct {
+	Device   string
+	Layout   []LegLayout
+	TickRate time.Duration
+
+	// the calibration to use; when it's nil the calibration is read from
+	// CalibrationPath (servos.DefaultCalibrationPath if that's empty too), falling
+	// back to servos.DefaultCalibration only if the file doesn't exist
+	Calibration     *servos.Calibration
+	CalibrationPath string
+
+	// drive simulated boards instead of talking to real hardware
+	Simulated bool
+}
+
+// servoDriver is a board the servos can be plugged in to
+type servoDriver interface {
+	servos.Controller
+	Reset() error
+}
+
+// Snapshot is a point in time view of the whole robot, suitable for logging
+type Snapshot struct {
+	Timestamp time.Time             `json:"timestamp"`
+	Legs      []legs.Snapshot       `json:"legs"`
+	Scheduler servos.SchedulerStats `json:"scheduler"`
+	Moving    bool                  `json:"moving"`
+	Power     PowerState            `json:"power"`
+	Voltage   float32               `json:"voltage"`
+	Thermal   ThermalState          `json:"thermal"`
+	Stability Stability             `json:"stability"`
+	Stance    Stance                `json:"stance"`
 }
 
-func New() (*Hexapod, error) {
+// New sets up the boards and legs, leaving every servo unpowered; call Startup to
+// bring the legs up
+func New(options *Options) (*Hexapod, error) {
+	opts := Options{
+		Device:          DefaultDevice,
+		Layout:          DefaultLayout,
+		CalibrationPath: servos.DefaultCalibrationPath,
+		TickRate:        servos.DefaultSchedulerTickRate,
+	}
+
+	if options != nil {
+		opts.Simulated = options.Simulated
+		opts.Calibration = options.Calibration
+
+		if options.Device != "" {
+			opts.Device = options.Device
+		}
+
+		if options.Layout != nil {
+			opts.Layout = options.Layout
+		}
+
+		if options.CalibrationPath != "" {
+			opts.CalibrationPath = options.CalibrationPath
+		}
+
+		if options.TickRate > 0 {
+			opts.TickRate = options.TickRate
+		}
+	}
+
 	hexapod := Hexapod{
 		legs:         []legs.Leg{},
 		i2cSlaves:    []*i2c.Options{},
-		servoDrivers: []*pca9685.PCA9685{},
+		servoDrivers: []servoDriver{},
+		scheduler:    servos.NewScheduler(opts.TickRate),
+		massModel:    DefaultMassModel,
 	}
 
-	// open i2c connections to the 2x servo controller slaves
-	slave1, _ := hexapod.addI2CSlave(0x40, "/dev/i2c-1")
-	// slave2, _ := hexapod.addI2CSlave(0x41, "/dev/i2c-1")
+	// read the calibration from disk unless one was handed over
+	if opts.Calibration == nil {
+		calibration, loaded, err := servos.LoadCalibrationOrDefault(opts.CalibrationPath)
+		if err != nil {
+			return nil, err
+		}
 
-	// initialize all of the servo drivers
-	servoDriver1, err := hexapod.addServoDriver(slave1)
-	if err != nil {
-		log.Fatal(err)
+		opts.Calibration = calibration
+		if loaded {
+			hexapod.calibrationPath = opts.CalibrationPath
+		}
 	}
-	// servoDriver2, _ := hexapod.addServoDriver(slave2)
 
-	// initialize all of the legs
-	hexapod.addLeg(0, servoDriver1)
-	hexapod.addLeg(3, servoDriver1)
-	hexapod.addLeg(6, servoDriver1)
-	// hexapod.addLeg(9, servoDriver1)
-	// hexapod.addLeg(12, servoDriver1)
-	// hexapod.addLeg(0, servoDriver2)
+	// initialize all of the legs, opening up each servo driver the first time it's used
+	servoDrivers := map[uint8]servoDriver{}
+	for _, layout := range opts.Layout {
+		servoDriver, ok := servoDrivers[layout.Address]
+		if !ok {
+			var err error
+			if servoDriver, err = hexapod.addServoDriver(layout.Address, opts.Device, opts.Simulated); err != nil {
+				hexapod.Shutdown()
+				return nil, err
+			}
+
+			servoDrivers[layout.Address] = servoDriver
+		}
+
+		if _, err := hexapod.addLeg(layout, servoDriver, opts.Calibration); err != nil {
+			hexapod.Shutdown()
+			return nil, err
+		}
+	}
+
+	// drive every servo from a single loop
+	hexapod.scheduler.Start()
 
 	return &hexapod, nil
 }
@@ -55,7 +159,19 @@ func (hp *Hexapod) addI2CSlave(address uint8, dev string) (*i2c.Options, error)
 	return slave, nil
 }
 
-func (hp *Hexapod) addServoDriver(slave *i2c.Options) (*pca9685.PCA9685, error) {
+func (hp *Hexapod) addServoDriver(address uint8, dev string, simulated bool) (servoDriver, error) {
+	if simulated {
+		servoDriver := simulator.New(address)
+		hp.servoDrivers = append(hp.servoDrivers, servoDriver)
+
+		return servoDriver, nil
+	}
+
+	slave, err := hp.addI2CSlave(address, dev)
+	if err != nil {
+		return nil, err
+	}
+
 	servoDriver, err := pca9685.New(slave, &pca9685.Options{
 		Frequency:  50,
 		ClockSpeed: 26430000,
@@ -70,34 +186,43 @@ func (hp *Hexapod) addServoDriver(slave *i2c.Options) (*pca9685.PCA9685, error)
 	return servoDriver, nil
 }
 
-func (hp *Hexapod) addLeg(channelOffset int, servoDriver *pca9685.PCA9685) (legs.Leg, error) {
-	coxa, err := servos.New(channelOffset, servoDriver, servos.ServoType_DS3225_90, 0)
-	if err != nil {
-		return legs.Leg{}, err
-	}
-
-	femur, err := servos.New(channelOffset+1, servoDriver, servos.ServoType_DS3225_135, 0)
-	if err != nil {
-		return legs.Leg{}, err
-	}
+func (hp *Hexapod) addLeg(layout LegLayout, servoDriver servoDriver, calibration *servos.Calibration) (legs.Leg, error) {
+	legServos := []*servos.Servo{}
+	for i, name := range layout.GetServoNames() {
+		servoType, err := calibration.GetServoType(name)
+		if err != nil {
+			return legs.Leg{}, err
+		}
 
-	tibia, err := servos.New(channelOffset+2, servoDriver, servos.ServoType_DS3225_135, 0)
-	if err != nil {
-		return legs.Leg{}, err
+		// nothing gets powered until the startup sequence runs
+		servo := servos.NewDetached(layout.ChannelOffset+i, servoDriver, servoType, 0)
+		legServos = append(legServos, servo)
 	}
 
-	leg := legs.New(coxa, femur, tibia)
+	leg := legs.New(layout.Side, legServos[0], legServos[1], legServos[2]).WithGeometry(layout.Geometry)
 	hp.legs = append(hp.legs, leg)
-	leg.Start()
+	hp.scheduler.Register(leg.GetServos()...)
 
 	return leg, nil
 }
 
+// Shutdown stops everything and resets the boards; it's safe to call more than once
 func (hp *Hexapod) Shutdown() {
-	// iterate through the legs, stopping each one
-	for _, leg := range hp.legs {
-		leg.Stop()
-	}
+	hp.shutdownOnce.Do(hp.shutdown)
+}
+
+func (hp *Hexapod) shutdown() {
+	// stop anything placing the feet
+	hp.reclaimLegs()
+
+	// stop watching the battery
+	hp.stopBatteryMonitor()
+
+	// stop watching the temperatures
+	hp.stopThermalMonitor()
+
+	// stop driving the servos
+	hp.scheduler.Stop()
 
 	// iterate through the boards and reset each one
 	for _, driver := range hp.servoDrivers {
@@ -110,12 +235,100 @@ func (hp *Hexapod) Shutdown() {
 	}
 }
 
+// MoveAllLegsToAngles halts whatever is driving the legs and moves every leg to the
+// given joint angles
 func (hp *Hexapod) MoveAllLegsToAngles(coxaAngle, femurAngle, tibiaAngle float32, duration time.Duration) {
+	hp.reclaimLegs()
+
 	for _, leg := range hp.legs {
 		leg.MoveToAngles(coxaAngle, femurAngle, tibiaAngle, duration)
 	}
 }
 
+// SitDown lowers the body onto the ground (by folding the legs up into the startup
+// pose), returning once the legs should have got there; any gait, body pose or stance
+// move is halted first
+func (hp *Hexapod) SitDown(duration time.Duration) {
+	hp.reclaimLegs()
+
+	for _, leg := range hp.legs {
+		leg.MoveToJointAngles(StartupPose, duration)
+	}
+
+	time.Sleep(duration)
+
+	// the body is resting on the ground now
+	for _, leg := range hp.legs {
+		leg.SetHoldingLoad(0)
+	}
+}
+
+// Detach lets every leg go limp (ie - for folding the robot up for transport)
+func (hp *Hexapod) Detach() error {
+	hp.reclaimLegs()
+
+	for _, leg := range hp.legs {
+		if err := leg.Detach(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Attach powers every leg back up, ramping from the pose they're assumed to be in
+// (from) to the given pose (to)
+func (hp *Hexapod) Attach(from, to legs.JointAngles, ramp time.Duration) error {
+	hp.reclaimLegs()
+
+	for _, leg := range hp.legs {
+		if err := leg.Attach(from, to, ramp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetCalibrationPath returns the file the calibration was read from, or an empty
+// string when it was handed to New or the built in DefaultCalibration is in use
+func (hp *Hexapod) GetCalibrationPath() string {
+	return hp.calibrationPath
+}
+
+func (hp *Hexapod) GetLegCount() int {
+	return len(hp.legs)
+}
+
 func (hp *Hexapod) GetLeg(index int) legs.Leg {
 	return hp.legs[index]
 }
+
+func (hp *Hexapod) GetScheduler() *servos.Scheduler {
+	return hp.scheduler
+}
+
+func (hp *Hexapod) SetTickRate(tickRate time.Duration) {
+	hp.scheduler.SetTickRate(tickRate)
+}
+
+func (hp *Hexapod) GetSnapshot() Snapshot {
+	snapshot := Snapshot{
+		Timestamp: time.Now(),
+		Legs:      []legs.Snapshot{},
+		Scheduler: hp.scheduler.GetStats(),
+		Power:     hp.GetPowerState(),
+		Voltage:   hp.GetBatteryVoltage(),
+		Thermal:   hp.GetThermalState(),
+		Stability: hp.GetStability(),
+		Stance:    hp.GetStance(),
+	}
+
+	for _, leg := range hp.legs {
+		legSnapshot := leg.GetSnapshot()
+		snapshot.Legs = append(snapshot.Legs, legSnapshot)
+		snapshot.Moving = snapshot.Moving || legSnapshot.Moving
+	}
+
+	return snapshot
+}
@@ -0,0 +1,50 @@
+package hexapod
+
+import (
+	"github.com/carldanley/hexapod/pkg/geometry"
+	"github.com/carldanley/hexapod/pkg/legs"
+)
+
+// LegLayout describes where a leg's servos are plugged in; the coxa, femur and tibia
+// use three consecutive channels starting at ChannelOffset
+type LegLayout struct {
+	Name          string
+	Side          legs.Side
+	Address       uint8
+	ChannelOffset int
+	Geometry      legs.LegGeometry
+}
+
+// DefaultLegGeometry is the link lengths (in millimetres) shared by every leg; legs 1
+// are at the front and legs 3 at the back
+var DefaultLegGeometry = legs.LegGeometry{
+	CoxaLength:  52,
+	FemurLength: 82,
+	TibiaLength: 122,
+}
+
+var DefaultLayout = []LegLayout{
+	{Name: "RightLeg1", Side: legs.Right, Address: 0x40, ChannelOffset: 0, Geometry: mountLeg(60, -40, -45)},
+	{Name: "RightLeg2", Side: legs.Right, Address: 0x40, ChannelOffset: 3, Geometry: mountLeg(0, -60, -90)},
+	{Name: "RightLeg3", Side: legs.Right, Address: 0x40, ChannelOffset: 6, Geometry: mountLeg(-60, -40, -135)},
+	{Name: "LeftLeg1", Side: legs.Left, Address: 0x41, ChannelOffset: 0, Geometry: mountLeg(60, 40, 45)},
+	{Name: "LeftLeg2", Side: legs.Left, Address: 0x41, ChannelOffset: 3, Geometry: mountLeg(0, 60, 90)},
+	{Name: "LeftLeg3", Side: legs.Left, Address: 0x41, ChannelOffset: 6, Geometry: mountLeg(-60, 40, 135)},
+}
+
+func mountLeg(x, y, yaw float64) legs.LegGeometry {
+	legGeometry := DefaultLegGeometry
+	legGeometry.Position = geometry.Vector{X: x, Y: y}
+	legGeometry.Yaw = yaw
+
+	return legGeometry
+}
+
+// GetServoNames returns the calibration names of the coxa, femur and tibia (in that order)
+func (ll LegLayout) GetServoNames() []string {
+	return []string{
+		ll.Name + "_Coxa",
+		ll.Name + "_Femur",
+		ll.Name + "_Tibia",
+	}
+}
@@ -0,0 +1,228 @@
+package hexapod
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/carldanley/hexapod/pkg/geometry"
+	"github.com/carldanley/hexapod/pkg/legs"
+)
+
+// feet within this distance (in millimetres) of the lowest foot count as on the ground
+const DefaultContactTolerance = 10
+
+// MassModel is how heavy (in grams) the body and each leg's links are; each link's
+// mass is taken to be at its middle, and the body's at BodyCenter
+type MassModel struct {
+	Body       float64         `json:"body"`
+	BodyCenter geometry.Vector `json:"bodyCenter"`
+	Coxa       float64         `json:"coxa"`
+	Femur      float64         `json:"femur"`
+	Tibia      float64         `json:"tibia"`
+}
+
+// DefaultMassModel is a guess for a body carrying the electronics and battery, with a
+// DS3225 at every joint
+var DefaultMassModel = MassModel{
+	Body:  900,
+	Coxa:  70,
+	Femur: 80,
+	Tibia: 40,
+}
+
+// Stability describes how close the robot is to tipping over; Margin is how far (in
+// millimetres) the centre of mass is inside the support polygon, negative if it's
+// outside
+type Stability struct {
+	CenterOfMass   geometry.Vector   `json:"centerOfMass"`
+	SupportPolygon []geometry.Vector `json:"supportPolygon"`
+	FeetDown       []bool            `json:"feetDown"`
+	Margin         float64           `json:"margin"`
+	Stable         bool              `json:"stable"`
+}
+
+// UnstableError is returned when lifting a leg would leave the centre of mass
+// outside the feet still on the ground
+type UnstableError struct {
+	Leg    int
+	Margin float64
+}
+
+func (ue *UnstableError) Error() string {
+	return fmt.Sprintf("lifting leg %d would leave a stability margin of %.2fmm", ue.Leg, ue.Margin)
+}
+
+func (hp *Hexapod) SetMassModel(massModel MassModel) {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	hp.massModel = massModel
+}
+
+func (hp *Hexapod) GetMassModel() MassModel {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	return hp.massModel
+}
+
+// GetCenterOfMass estimates the centre of mass (in the body frame) from the mass model
+// and where the joints are right now
+func (hp *Hexapod) GetCenterOfMass() geometry.Vector {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	return hp.centerOfMass()
+}
+
+// centerOfMass needs the hexapod's mutex to be held
+func (hp *Hexapod) centerOfMass() geometry.Vector {
+	massModel := hp.massModel
+
+	total := massModel.Body
+	moment := massModel.BodyCenter.Scale(massModel.Body)
+
+	for _, leg := range hp.legs {
+		angles := leg.GetAngles()
+		joints := leg.JointPositions(angles.Coxa, angles.Femur, angles.Tibia)
+
+		for i, mass := range []float64{massModel.Coxa, massModel.Femur, massModel.Tibia} {
+			middle := joints[i].Add(joints[i+1]).Scale(0.5)
+			moment = moment.Add(middle.Scale(mass))
+			total += mass
+		}
+	}
+
+	if total <= 0 {
+		return geometry.Vector{}
+	}
+
+	return moment.Scale(1 / total)
+}
+
+// GetFeetDown works out which feet are on the ground, taking every foot close enough
+// to the lowest one (measured along gravity, so a tilted body doesn't lift a side)
+func (hp *Hexapod) GetFeetDown() []bool {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	return hp.feetDown()
+}
+
+// worldFeet returns where every foot is in the frame the feet stand in (see
+// BodyPose); the hexapod's mutex must be held
+func (hp *Hexapod) worldFeet() []geometry.Vector {
+	feet := []geometry.Vector{}
+	for _, leg := range hp.legs {
+		feet = append(feet, hp.bodyPose.BodyToWorld(leg.GetFootPosition()))
+	}
+
+	return feet
+}
+
+// feetDown needs the hexapod's mutex to be held
+func (hp *Hexapod) feetDown() []bool {
+	feet := hp.worldFeet()
+
+	lowest := 0.0
+	for i, foot := range feet {
+		if (i == 0) || (foot.Z < lowest) {
+			lowest = foot.Z
+		}
+	}
+
+	down := []bool{}
+	for _, foot := range feet {
+		down = append(down, foot.Z <= lowest+DefaultContactTolerance)
+	}
+
+	return down
+}
+
+// GetStability works out the support polygon from the feet on the ground and how far
+// inside it the centre of mass is, both in the frame the feet stand in (see
+// BodyPose) so the centre of mass is projected along gravity
+func (hp *Hexapod) GetStability() Stability {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	return hp.stability(hp.feetDown())
+}
+
+// stability needs the hexapod's mutex to be held
+func (hp *Hexapod) stability(feetDown []bool) Stability {
+	support := []geometry.Vector{}
+	for i, foot := range hp.worldFeet() {
+		if feetDown[i] {
+			support = append(support, foot)
+		}
+	}
+
+	stability := Stability{
+		CenterOfMass:   hp.bodyPose.BodyToWorld(hp.centerOfMass()),
+		SupportPolygon: geometry.ConvexHull(support),
+		FeetDown:       feetDown,
+	}
+
+	stability.Margin = geometry.PolygonMargin(stability.SupportPolygon, stability.CenterOfMass)
+	stability.Stable = stability.Margin > 0
+
+	return stability
+}
+
+// CheckLift returns an UnstableError if lifting the leg would leave the centre of
+// mass outside (or within minMargin millimetres of the edge of) the other feet
+func (hp *Hexapod) CheckLift(index int, minMargin float64) error {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	return hp.checkLift(index, minMargin)
+}
+
+// checkLift needs the hexapod's mutex to be held
+func (hp *Hexapod) checkLift(index int, minMargin float64) error {
+	feetDown := hp.feetDown()
+	feetDown[index] = false
+
+	stability := hp.stability(feetDown)
+	if stability.Margin < minMargin {
+		return &UnstableError{Leg: index, Margin: stability.Margin}
+	}
+
+	return nil
+}
+
+// LiftLeg raises a foot straight up (against gravity) by height millimetres over
+// duration, refusing if that would leave the robot unstable. Like FollowPath it takes
+// over from any body pose or stance move, and it returns ErrLegsInUse while a leg
+// controller holds the legs.
+func (hp *Hexapod) LiftLeg(index int, height float64, duration time.Duration) error {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	if (index < 0) || (index >= len(hp.legs)) {
+		return fmt.Errorf("leg %d is out of range", index)
+	}
+
+	if hp.legController != nil {
+		return ErrLegsInUse
+	}
+
+	if err := hp.checkLift(index, 0); err != nil {
+		return err
+	}
+
+	hp.cancelPaths()
+	hp.bodyPoseTask = nil
+	hp.endStance(ErrStanceReplaced)
+
+	// the foot lifts from wherever it's heading
+	leg := hp.legs[index]
+	angles := leg.GetTargetAngles()
+	_, foot := leg.ForwardKinematics(angles.Coxa, angles.Femur, angles.Tibia)
+	raised := hp.bodyPose.WorldToBody(hp.bodyPose.BodyToWorld(foot).Add(geometry.Vector{Z: height}))
+
+	_, err := leg.FollowPath(hp.scheduler, legs.Line{From: foot, To: raised}, duration, "SineInOut")
+
+	return err
+}
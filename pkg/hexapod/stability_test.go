@@ -0,0 +1,35 @@
+package hexapod
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carldanley/hexapod/pkg/geometry"
+)
+
+func TestCheckLiftWithRolledBody(t *testing.T) {
+	hp := newTestHexapod(t)
+
+	if err := hp.SetBodyPose(geometry.Vector{}, 8, 0, 0, 500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	hp.run(time.Second)
+
+	// tilting the body doesn't lift the feet off the ground
+	for i, down := range hp.GetFeetDown() {
+		if !down {
+			t.Errorf("leg %d counts as lifted with the body rolled", i)
+		}
+	}
+
+	if stability := hp.GetStability(); !stability.Stable {
+		t.Errorf("stability margin = %.2fmm with every foot down", stability.Margin)
+	}
+
+	for i := 0; i < hp.GetLegCount(); i++ {
+		if err := hp.CheckLift(i, 0); err != nil {
+			t.Errorf("CheckLift(%d) = %v, the other five feet are down", i, err)
+		}
+	}
+}
@@ -0,0 +1,470 @@
+package hexapod
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/carldanley/hexapod/pkg/geometry"
+	"github.com/carldanley/hexapod/pkg/legs"
+)
+
+// how many stances along the way are checked before the feet start moving
+const stanceCheckPoints = 16
+
+// step (in millimetres) used when searching for the height and spread limits
+const stanceLimitStep = 1
+
+// how many directions around its neutral position a foot's stride is checked in
+const strideCheckDirections = 8
+
+// how many points along each part of a stride are checked
+const strideCheckPoints = 8
+
+// ErrStanceReplaced is returned by WaitForStance when another stance move (or anything
+// that takes the legs back, see LegController) took over before the move finished
+var ErrStanceReplaced = errors.New("the stance move was taken over before it finished")
+
+// ErrStanceStopped is returned by WaitForStance when the scheduler stops before the
+// stance move finished
+var ErrStanceStopped = errors.New("the scheduler stopped before the stance move finished")
+
+// Stance is where the feet sit relative to the body: Height is how far (in
+// millimetres) the body is above the ground, and Spread how far each foot is out from
+// its coxa joint, along the direction the leg is mounted in
+type Stance struct {
+	Height float64 `json:"height"`
+	Spread float64 `json:"spread"`
+}
+
+// stanceTask moves the feet towards a new stance on every scheduler tick; err and done
+// are guarded by the hexapod's mutex
+type stanceTask struct {
+	hexapod   *Hexapod
+	feet      []geometry.Vector
+	from      Stance
+	to        Stance
+	duration  time.Duration
+	startTime time.Time
+	err       error
+	done      chan bool
+}
+
+// GetStance returns the current stance; until one has been set it's estimated from
+// wherever the feet are heading
+func (hp *Hexapod) GetStance() Stance {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	return hp.currentStance()
+}
+
+// HasStance reports whether a stance has been set, rather than just estimated
+func (hp *Hexapod) HasStance() bool {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	return hp.stanceKnown
+}
+
+// currentStance needs the hexapod's mutex to be held
+func (hp *Hexapod) currentStance() Stance {
+	if hp.stanceKnown {
+		return hp.stance
+	}
+
+	// like the feet a new stance starts from, the estimate goes by where the legs are
+	// heading rather than where they've got to
+	estimate := Stance{}
+	for _, leg := range hp.legs {
+		angles := leg.GetTargetAngles()
+		_, foot := leg.ForwardKinematics(angles.Coxa, angles.Femur, angles.Tibia)
+
+		legGeometry := leg.GetGeometry()
+		foot = legGeometry.BodyToLeg(foot)
+
+		estimate.Height -= foot.Z
+		estimate.Spread += math.Hypot(foot.X, foot.Y)
+	}
+
+	return Stance{
+		Height: estimate.Height / float64(len(hp.legs)),
+		Spread: estimate.Spread / float64(len(hp.legs)),
+	}
+}
+
+// GetNeutralFoot returns where a foot sits (in the body frame) for the given stance
+func (hp *Hexapod) GetNeutralFoot(index int, stance Stance) geometry.Vector {
+	leg := hp.legs[index]
+	legGeometry := leg.GetGeometry()
+
+	return legGeometry.LegToBody(geometry.Vector{X: stance.Spread, Z: -stance.Height})
+}
+
+// SetBodyHeight raises or lowers the body to height millimetres above the ground
+// over duration, keeping the current spread (see SetStance)
+func (hp *Hexapod) SetBodyHeight(height float64, duration time.Duration) error {
+	stance := hp.GetStance()
+	stance.Height = height
+
+	if err := hp.SetStance(stance, duration); err != nil {
+		// the limits only explain the failure if the height is outside them (the scan
+		// can step over a gap narrower than stanceLimitStep)
+		minHeight, maxHeight, limitErr := hp.GetHeightLimits(stance.Spread)
+		if (limitErr != nil) || ((height >= minHeight) && (height <= maxHeight)) {
+			return err
+		}
+
+		return fmt.Errorf("body height %.1fmm is outside %.1fmm to %.1fmm: %w", height, minHeight, maxHeight, err)
+	}
+
+	return nil
+}
+
+// SetFootSpread moves the feet in or out to spread millimetres from their coxa
+// joints over duration, keeping the current height (see SetStance)
+func (hp *Hexapod) SetFootSpread(spread float64, duration time.Duration) error {
+	stance := hp.GetStance()
+	stance.Spread = spread
+
+	if err := hp.SetStance(stance, duration); err != nil {
+		minSpread, maxSpread, limitErr := hp.GetSpreadLimits(stance.Height)
+		if (limitErr != nil) || ((spread >= minSpread) && (spread <= maxSpread)) {
+			return err
+		}
+
+		return fmt.Errorf("foot spread %.1fmm is outside %.1fmm to %.1fmm: %w", spread, minSpread, maxSpread, err)
+	}
+
+	return nil
+}
+
+// SetStance moves to the given stance over duration, sliding the feet with inverse
+// kinematics on every tick; every stance along the way is checked first, so nothing
+// moves if a leg can't reach. Any trajectory is cancelled first, and any body pose
+// move is stopped where it got to. While a leg controller (ie - a gait) holds the
+// legs, it moves the feet instead. Use WaitForStance to find out how the move went.
+func (hp *Hexapod) SetStance(stance Stance, duration time.Duration) error {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	hp.cancelPaths()
+
+	// the feet keep their offsets from neutral (ie - after SetBodyPose)
+	from := hp.currentStance()
+	feet := []geometry.Vector{}
+	for _, leg := range hp.legs {
+		angles := leg.GetTargetAngles()
+		_, foot := leg.ForwardKinematics(angles.Coxa, angles.Femur, angles.Tibia)
+		feet = append(feet, foot)
+	}
+
+	for i := 0; i <= stanceCheckPoints; i++ {
+		checkpoint := blendStance(from, stance, float64(i)/stanceCheckPoints)
+		if err := hp.checkStance(from, checkpoint); err != nil {
+			return err
+		}
+
+		// without a leg controller, the feet themselves are moved
+		if hp.legController == nil {
+			if _, err := hp.solveStance(feet, from, checkpoint); err != nil {
+				return err
+			}
+		}
+	}
+
+	task := &stanceTask{
+		hexapod:  hp,
+		feet:     feet,
+		from:     from,
+		to:       stance,
+		duration: duration,
+		done:     make(chan bool),
+	}
+
+	// a new stance takes over from wherever the last one (or a body pose move) got to
+	hp.bodyPoseTask = nil
+	hp.endStance(ErrStanceReplaced)
+	hp.stance = from
+	hp.stanceKnown = true
+	hp.stanceTask = task
+	hp.scheduler.AddTask(task)
+
+	return nil
+}
+
+// WaitForStance blocks until the latest stance move finishes, returning why it stopped
+// early if it did (ie - ErrStanceReplaced, or the legs.UnreachableError that stopped
+// it part way)
+func (hp *Hexapod) WaitForStance() error {
+	hp.mutex.Lock()
+	task := hp.stanceTask
+	hp.mutex.Unlock()
+
+	if task == nil {
+		return nil
+	}
+
+	select {
+	case <-task.done:
+	case <-hp.scheduler.Done():
+		if !task.isDone() {
+			return ErrStanceStopped
+		}
+	}
+
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	return task.err
+}
+
+// endStance finishes the latest stance move (if it's still going); the hexapod's
+// mutex must be held
+func (hp *Hexapod) endStance(err error) {
+	if hp.stanceTask != nil {
+		hp.stanceTask.finish(err)
+	}
+}
+
+// checkStance makes sure every leg can reach its neutral foot position for the stance
+// and, while a leg controller holds the legs, walk there from the from stance (see
+// checkStrides); the hexapod's mutex must be held
+func (hp *Hexapod) checkStance(from, stance Stance) error {
+	for i, leg := range hp.legs {
+		if _, err := leg.InverseKinematics(hp.GetNeutralFoot(i, stance)); err != nil {
+			return fmt.Errorf("leg %d: %w", i, err)
+		}
+
+		if hp.legController == nil {
+			continue
+		}
+
+		if err := hp.checkStrides(i, from, stance); err != nil {
+			return fmt.Errorf("leg %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// checkStrides checks the paths a leg controller takes a foot along while the stance
+// changes. A foot on the ground only follows the height, so it finishes the stride
+// it's taking around the from stance's neutral position, steps over to the new one
+// and walks on from there; as well as that stride, the foot has to be able to step on
+// the spot and leave room to stride the whole stride length in any direction.
+func (hp *Hexapod) checkStrides(index int, from, stance Stance) error {
+	leg := hp.legs[index]
+	neutral := hp.GetNeutralFoot(index, stance)
+	shift := geometry.Vector{Z: neutral.Z - hp.GetNeutralFoot(index, from).Z}
+	foothold := hp.GetNeutralFoot(index, from).Add(shift)
+	height := hp.footwork.StepHeight
+
+	angles := leg.GetTargetAngles()
+	_, foot := leg.ForwardKinematics(angles.Coxa, angles.Femur, angles.Tibia)
+
+	half := geometry.Vector{}
+	if index < len(hp.footwork.Strides) {
+		half = hp.footwork.Strides[index].Scale(0.5)
+	}
+
+	paths := []legs.Path{
+		legs.Line{From: foot.Add(shift), To: foot.Add(shift)},
+		legs.Line{From: foothold.Sub(half), To: foothold.Add(half)},
+		legs.Step{From: foothold.Add(half), To: neutral.Sub(half), Height: height},
+		legs.Step{From: neutral.Add(half), To: neutral.Sub(half), Height: height},
+		legs.Step{From: neutral, To: neutral, Height: height},
+	}
+
+	for direction := 0; direction < strideCheckDirections; direction++ {
+		heading := 360 * float64(direction) / strideCheckDirections
+		stride := geometry.Vector{X: hp.footwork.StrideLength / 2}.RotateZ(heading)
+		paths = append(paths, legs.Line{From: neutral, To: neutral.Add(stride)})
+	}
+
+	for _, path := range paths {
+		for i := 0; i <= strideCheckPoints; i++ {
+			if _, err := leg.InverseKinematics(path.PointAt(float64(i) / strideCheckPoints)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetHeightLimits returns the lowest and highest body heights every leg can reach
+// with the given spread (leaving room to step while walking), without passing
+// through any height they can't reach on the way from the current one
+func (hp *Hexapod) GetHeightLimits(spread float64) (float64, float64, error) {
+	return hp.stanceLimits(
+		func(stance Stance) float64 { return stance.Height },
+		func(height float64) Stance { return Stance{Height: height, Spread: spread} },
+	)
+}
+
+// GetSpreadLimits returns the narrowest and widest foot spreads every leg can reach
+// at the given body height (leaving room to step while walking), without passing
+// through any spread they can't reach on the way from the current one
+func (hp *Hexapod) GetSpreadLimits(height float64) (float64, float64, error) {
+	return hp.stanceLimits(
+		func(stance Stance) float64 { return stance.Spread },
+		func(spread float64) Stance { return Stance{Height: height, Spread: spread} },
+	)
+}
+
+// stanceLimits scans the values stanceAt turns into stances for the reachable ones;
+// the joint limits can split those into several ranges, in which case the one the
+// current stance's value (valueOf) is in, or else the closest, is returned
+func (hp *Hexapod) stanceLimits(valueOf func(stance Stance) float64, stanceAt func(value float64) Stance) (float64, float64, error) {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	// nothing can reach further than its whole leg
+	reach := 0.0
+	for _, leg := range hp.legs {
+		legGeometry := leg.GetGeometry()
+		reach = math.Max(reach, legGeometry.CoxaLength+legGeometry.FemurLength+legGeometry.TibiaLength)
+	}
+
+	type valueRange struct {
+		lowest, highest float64
+	}
+
+	current := hp.currentStance()
+	ranges := []valueRange{}
+	inRange := false
+	for value := 0.0; value <= reach; value += stanceLimitStep {
+		if hp.checkStance(current, stanceAt(value)) != nil {
+			inRange = false
+			continue
+		}
+
+		if !inRange {
+			ranges = append(ranges, valueRange{lowest: value})
+			inRange = true
+		}
+
+		ranges[len(ranges)-1].highest = value
+	}
+
+	if len(ranges) == 0 {
+		return 0, 0, fmt.Errorf("no stance is reachable by every leg")
+	}
+
+	distanceTo := func(r valueRange) float64 {
+		return math.Max(0, math.Max(r.lowest-valueOf(current), valueOf(current)-r.highest))
+	}
+
+	closest := ranges[0]
+	for _, r := range ranges[1:] {
+		if distanceTo(r) < distanceTo(closest) {
+			closest = r
+		}
+	}
+
+	return closest.lowest, closest.highest, nil
+}
+
+// solveStance works out every leg's joint angles for moveFeetToStance
+func (hp *Hexapod) solveStance(feet []geometry.Vector, from, stance Stance) ([]legs.JointAngles, error) {
+	solutions := []legs.JointAngles{}
+	for i, leg := range hp.legs {
+		shift := hp.GetNeutralFoot(i, stance).Sub(hp.GetNeutralFoot(i, from))
+
+		solution, err := leg.InverseKinematics(feet[i].Add(shift))
+		if err != nil {
+			return nil, fmt.Errorf("leg %d: %w", i, err)
+		}
+
+		solutions = append(solutions, solution)
+	}
+
+	return solutions, nil
+}
+
+func blendStance(from, to Stance, progress float64) Stance {
+	return Stance{
+		Height: from.Height + (to.Height-from.Height)*progress,
+		Spread: from.Spread + (to.Spread-from.Spread)*progress,
+	}
+}
+
+// Tick only ever runs on the scheduler's goroutine
+func (st *stanceTask) Tick(now time.Time) bool {
+	if st.startTime.IsZero() {
+		st.startTime = now
+	}
+
+	elapsed := now.Sub(st.startTime)
+	progress := float32(1)
+	if elapsed < st.duration {
+		progress = BodyPoseEasing(float32(elapsed.Seconds()), 0, 1, float32(st.duration.Seconds()))
+	}
+
+	hp := st.hexapod
+	stance := blendStance(st.from, st.to, float64(progress))
+
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	// a newer stance (or something else) has taken over
+	if st.isDone() {
+		return false
+	}
+
+	// a leg controller follows the stance by itself
+	if hp.legController == nil {
+		if err := hp.moveFeetToStance(st.feet, st.from, stance, now); err != nil {
+			// every stance was checked up front, so only an overshooting easing gets
+			// here; stay where we got to
+			st.finish(fmt.Errorf("stance move stopped part way: %w", err))
+			return false
+		}
+	}
+
+	hp.stance = stance
+
+	if elapsed >= st.duration {
+		st.finish(nil)
+		return false
+	}
+
+	return true
+}
+
+// finish ends the move, recording why if it stopped early; the hexapod's mutex must
+// be held
+func (st *stanceTask) finish(err error) {
+	if st.isDone() {
+		return
+	}
+
+	st.err = err
+	close(st.done)
+}
+
+func (st *stanceTask) isDone() bool {
+	select {
+	case <-st.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// moveFeetToStance shifts every foot from where it was at the from stance by however
+// far its neutral position has moved since
+func (hp *Hexapod) moveFeetToStance(feet []geometry.Vector, from, stance Stance, now time.Time) error {
+	solutions, err := hp.solveStance(feet, from, stance)
+	if err != nil {
+		return err
+	}
+
+	for i, leg := range hp.legs {
+		leg.SetJointAnglesAt(solutions[i], now)
+	}
+
+	return nil
+}
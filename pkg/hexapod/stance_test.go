@@ -0,0 +1,120 @@
+package hexapod
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/carldanley/hexapod/pkg/geometry"
+	"github.com/carldanley/hexapod/pkg/servos"
+)
+
+// testHexapod is a simulated hexapod stood up on its feet, whose scheduler only ticks
+// when the test steps it
+type testHexapod struct {
+	*Hexapod
+	now time.Time
+}
+
+func newTestHexapod(t *testing.T) *testHexapod {
+	t.Helper()
+
+	hp, err := New(&Options{
+		Simulated:   true,
+		Calibration: servos.DefaultCalibration(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(hp.Shutdown)
+	hp.GetScheduler().Stop()
+
+	err = hp.Startup(&StartupSequence{
+		Groups:      [][]int{{0, 1, 2, 3, 4, 5}},
+		InitialPose: StartupPose,
+		RestPose:    StandingPose,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	th := &testHexapod{Hexapod: hp, now: time.Now()}
+	th.run(time.Second)
+
+	return th
+}
+
+func (th *testHexapod) run(duration time.Duration) {
+	end := th.now.Add(duration)
+
+	for th.now.Before(end) {
+		th.now = th.now.Add(th.scheduler.GetTickRate())
+		th.scheduler.Step(th.now)
+	}
+}
+
+func TestSetBodyPoseReplacesStance(t *testing.T) {
+	hp := newTestHexapod(t)
+
+	stance := hp.GetStance()
+	stance.Height += 20
+	if err := hp.SetStance(stance, 500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	hp.run(100 * time.Millisecond)
+
+	translation := geometry.Vector{X: 10}
+	if err := hp.SetBodyPose(translation, 0, 0, 0, 500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hp.WaitForStance(); !errors.Is(err, ErrStanceReplaced) {
+		t.Errorf("WaitForStance() = %v, want %v", err, ErrStanceReplaced)
+	}
+
+	// the stance move mustn't carry on fighting the body pose for the legs
+	hp.run(time.Second)
+
+	if got := hp.GetBodyPose(); got.Translation.Sub(translation).Length() > 1e-6 {
+		t.Errorf("body pose = %v, want the translation at %s", got, translation)
+	}
+
+	if got := hp.GetStance(); math.Abs(got.Height-stance.Height) < 1 {
+		t.Errorf("stance height = %.2fmm, the replaced move still finished", got.Height)
+	}
+}
+
+func TestSetStanceReplacesBodyPose(t *testing.T) {
+	hp := newTestHexapod(t)
+
+	translation := geometry.Vector{X: 10}
+	if err := hp.SetBodyPose(translation, 0, 0, 0, 500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	hp.run(100 * time.Millisecond)
+
+	stance := hp.GetStance()
+	stance.Height += 20
+	if err := hp.SetStance(stance, 500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	hp.run(time.Second)
+
+	if err := hp.WaitForStance(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the body stops wherever it had got to
+	if got := hp.GetBodyPose(); got.Translation.Sub(translation).Length() < 1 {
+		t.Errorf("body pose = %v, the replaced move still finished", got)
+	}
+
+	if got := hp.GetStance(); math.Abs(got.Height-stance.Height) > 1e-6 {
+		t.Errorf("stance height = %.2fmm, want %.2fmm", got.Height, stance.Height)
+	}
+}
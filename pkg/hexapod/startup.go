@@ -0,0 +1,116 @@
+package hexapod
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/carldanley/hexapod/pkg/legs"
+)
+
+// StartupSequence powers the servos up a few at a time rather than all at once, which
+// would brown out the supply
+type StartupSequence struct {
+	// leg indexes that are powered together, in order; every leg has to appear once
+	Groups [][]int
+
+	// how long to wait between groups, and between the joints of a single leg
+	GroupDelay time.Duration
+	JointDelay time.Duration
+
+	// where the legs are assumed to be when power is applied (ie - folded up)
+	InitialPose legs.JointAngles
+
+	// where the legs end up, and how long they take to get there
+	RestPose     legs.JointAngles
+	RampDuration time.Duration
+}
+
+// StartupPose has the legs folded up with the body resting on the ground
+var StartupPose = legs.JointAngles{Coxa: 0, Femur: 120, Tibia: 135}
+
+// StandingPose has the body held up off the ground on all six feet
+var StandingPose = legs.JointAngles{Coxa: 0, Femur: 25, Tibia: 110}
+
+var DefaultStartupSequence = StartupSequence{
+	Groups:       [][]int{{0}, {4}, {2}, {3}, {1}, {5}},
+	GroupDelay:   250 * time.Millisecond,
+	JointDelay:   50 * time.Millisecond,
+	InitialPose:  StartupPose,
+	RestPose:     StandingPose,
+	RampDuration: time.Second,
+}
+
+// Startup runs through the startup sequence (or the default one if nil), returning
+// once the last group has been powered; the ramp to the rest pose carries on afterwards
+func (hp *Hexapod) Startup(sequence *StartupSequence) error {
+	if sequence == nil {
+		sequence = &DefaultStartupSequence
+	}
+
+	if err := hp.checkStartupGroups(sequence.Groups); err != nil {
+		return err
+	}
+
+	hp.reclaimLegs()
+
+	for i, group := range sequence.Groups {
+		if i > 0 {
+			time.Sleep(sequence.GroupDelay)
+		}
+
+		for _, index := range group {
+			if err := hp.startupLeg(hp.legs[index], sequence); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkStartupGroups makes sure every leg is powered exactly once, so none are left
+// limp (or powered up twice)
+func (hp *Hexapod) checkStartupGroups(groups [][]int) error {
+	seen := map[int]bool{}
+	for _, group := range groups {
+		for _, index := range group {
+			if (index < 0) || (index >= len(hp.legs)) {
+				return fmt.Errorf("invalid leg index in startup sequence: %d", index)
+			}
+
+			if seen[index] {
+				return fmt.Errorf("leg %d appears more than once in the startup sequence", index)
+			}
+
+			seen[index] = true
+		}
+	}
+
+	for index := range hp.legs {
+		if !seen[index] {
+			return fmt.Errorf("leg %d is missing from the startup sequence", index)
+		}
+	}
+
+	return nil
+}
+
+func (hp *Hexapod) startupLeg(leg legs.Leg, sequence *StartupSequence) error {
+	// power the joints up one at a time, holding them where they're assumed to be;
+	// each joint's first pulse goes out with the scheduler's next tick
+	for i, joint := range legs.Joints {
+		if i > 0 {
+			time.Sleep(sequence.JointDelay)
+		}
+
+		angle := sequence.InitialPose.Get(joint)
+		if err := leg.AttachJoint(joint, angle, angle, 0); err != nil {
+			return err
+		}
+	}
+
+	// and then ease over to the rest pose
+	leg.MoveToJointAngles(sequence.RestPose, sequence.RampDuration)
+
+	return nil
+}
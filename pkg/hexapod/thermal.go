@@ -0,0 +1,356 @@
+package hexapod
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/carldanley/hexapod/pkg/legs"
+)
+
+type ThermalState int
+
+const (
+	ThermalUnknown ThermalState = iota
+	ThermalNormal
+	ThermalLowered
+	ThermalResting
+)
+
+func (ts ThermalState) String() string {
+	switch ts {
+	case ThermalUnknown:
+		return "unknown"
+	case ThermalNormal:
+		return "normal"
+	case ThermalLowered:
+		return "lowered"
+	case ThermalResting:
+		return "resting"
+	}
+
+	return fmt.Sprintf("ThermalState(%d)", int(ts))
+}
+
+func (ts ThermalState) MarshalText() ([]byte, error) {
+	return []byte(ts.String()), nil
+}
+
+// JointTemperature is the estimated temperature of a single joint
+type JointTemperature struct {
+	Leg         int        `json:"leg"`
+	Joint       legs.Joint `json:"joint"`
+	Temperature float32    `json:"temperature"`
+	Projected   float32    `json:"projected"`
+}
+
+type ThermalOptions struct {
+	// how often the temperatures are checked
+	Interval time.Duration
+
+	// temperature (in celsius) no joint should go past, and how far ahead to look
+	// when deciding whether one will
+	LimitTemperature float32
+	Horizon          time.Duration
+
+	// a joint has to cool this far below the limit before the body is raised again
+	Hysteresis float32
+
+	// the body height (in millimetres) the body drops to when a joint is projected to
+	// overheat (it takes less torque to hold), keeping the feet where they are, and how
+	// long getting there (or sitting down) takes
+	LowerHeight     float64
+	MoveDuration    time.Duration
+	SitDownDuration time.Duration
+
+	// called (from the thermal monitor's goroutine) when the state changes
+	OnChange func(state ThermalState, hottest JointTemperature)
+}
+
+var DefaultThermalOptions = ThermalOptions{
+	Interval:         time.Second,
+	LimitTemperature: 70,
+	Horizon:          time.Minute,
+	Hysteresis:       10,
+	LowerHeight:      60,
+	MoveDuration:     time.Second,
+	SitDownDuration:  2 * time.Second,
+}
+
+type thermalMonitor struct {
+	mutex           sync.Mutex
+	options         ThermalOptions
+	state           ThermalState
+	hottest         JointTemperature
+	stopWorkChannel chan bool
+	doneChannel     chan bool
+
+	// the stance before the body was lowered, to raise it back to (only touched by
+	// the monitor's goroutine)
+	raisedStance Stance
+	raised       bool
+}
+
+// MonitorTemperature starts watching the estimated joint temperatures; when a joint
+// is projected to overheat the body is lowered, and if one overheats anyway the
+// hexapod sits down and lets go of its legs until they've cooled off
+func (hp *Hexapod) MonitorTemperature(options *ThermalOptions) error {
+	opts := DefaultThermalOptions
+	if options != nil {
+		opts = *options
+	}
+
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultThermalOptions.Interval
+	}
+
+	if opts.Hysteresis < 0 {
+		return fmt.Errorf("hysteresis (%f) must not be negative", opts.Hysteresis)
+	}
+
+	if opts.LowerHeight <= 0 {
+		return fmt.Errorf("lower height (%f) must be positive", opts.LowerHeight)
+	}
+
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	if hp.thermal != nil {
+		return fmt.Errorf("temperature is already being monitored")
+	}
+
+	hp.thermal = &thermalMonitor{
+		options:         opts,
+		state:           ThermalUnknown,
+		stopWorkChannel: make(chan bool),
+		doneChannel:     make(chan bool),
+	}
+
+	go hp.monitorTemperature(hp.thermal)
+
+	return nil
+}
+
+// GetJointTemperatures returns the estimated temperature of every joint, projected
+// forward by horizon
+func (hp *Hexapod) GetJointTemperatures(horizon time.Duration) []JointTemperature {
+	temperatures := []JointTemperature{}
+	for index, leg := range hp.legs {
+		for _, joint := range legs.Joints {
+			servo := leg.GetServo(joint)
+			temperatures = append(temperatures, JointTemperature{
+				Leg:         index,
+				Joint:       joint,
+				Temperature: servo.GetTemperature(),
+				Projected:   servo.ProjectTemperature(horizon),
+			})
+		}
+	}
+
+	return temperatures
+}
+
+func (hp *Hexapod) GetThermalState() ThermalState {
+	thermal := hp.getThermal()
+	if thermal == nil {
+		return ThermalUnknown
+	}
+
+	thermal.mutex.Lock()
+	defer thermal.mutex.Unlock()
+
+	return thermal.state
+}
+
+func (hp *Hexapod) getThermal() *thermalMonitor {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+
+	return hp.thermal
+}
+
+func (hp *Hexapod) stopThermalMonitor() {
+	hp.mutex.Lock()
+	thermal := hp.thermal
+	hp.mutex.Unlock()
+
+	if thermal == nil {
+		return
+	}
+
+	thermal.mutex.Lock()
+	stopWorkChannel := thermal.stopWorkChannel
+	thermal.stopWorkChannel = nil
+	thermal.mutex.Unlock()
+
+	if stopWorkChannel != nil {
+		close(stopWorkChannel)
+	}
+
+	<-thermal.doneChannel
+}
+
+func (hp *Hexapod) monitorTemperature(thermal *thermalMonitor) {
+	defer close(thermal.doneChannel)
+
+	ticker := time.NewTicker(thermal.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-thermal.stopWorkChannel:
+			return
+		case <-ticker.C:
+			previous := thermal.getState()
+			state, hottest := thermal.record(hp.GetJointTemperatures(thermal.options.Horizon))
+			if state == previous {
+				continue
+			}
+
+			switch state {
+			case ThermalNormal:
+				hp.raiseBody(thermal)
+			case ThermalLowered:
+				if previous == ThermalResting {
+					hp.standUpLowered(thermal)
+				} else {
+					hp.lowerBody(thermal)
+				}
+			case ThermalResting:
+				hp.rememberStance(thermal)
+				hp.SitDown(thermal.options.SitDownDuration)
+				// sitting down has taken the weight off, so a failure to let go is not fatal
+				hp.Detach()
+			}
+
+			if thermal.options.OnChange != nil {
+				thermal.options.OnChange(state, hottest)
+			}
+		}
+	}
+}
+
+// lowerBody drops the body to the lowered height (or as close as the legs reach),
+// remembering the stance to raise it back to
+func (hp *Hexapod) lowerBody(thermal *thermalMonitor) {
+	hp.rememberStance(thermal)
+
+	stance := hp.GetStance()
+	height := hp.loweredHeight(thermal, stance)
+
+	// a stance that can't be reached leaves the body where it is; the joints carry on
+	// heating up until the hexapod sits down
+	hp.SetBodyHeight(height, thermal.options.MoveDuration)
+}
+
+// standUpLowered powers the legs back up after resting, pushing the body up off the
+// ground to the lowered height at the spread it had before; if that can't be reached
+// the legs are just held folded up in the startup pose
+func (hp *Hexapod) standUpLowered(thermal *thermalMonitor) {
+	stance := Stance{
+		Height: hp.loweredHeight(thermal, thermal.raisedStance),
+		Spread: thermal.raisedStance.Spread,
+	}
+
+	poses := []legs.JointAngles{}
+	for i, leg := range hp.legs {
+		angles, err := leg.InverseKinematics(hp.GetNeutralFoot(i, stance))
+		if err != nil {
+			hp.Attach(StartupPose, StartupPose, 0)
+			return
+		}
+
+		poses = append(poses, angles)
+	}
+
+	hp.reclaimLegs()
+
+	for i, leg := range hp.legs {
+		// the legs were folded up when they were let go of
+		leg.Attach(StartupPose, poses[i], thermal.options.MoveDuration)
+	}
+}
+
+// rememberStance keeps the stance from before the body was first lowered (or sat
+// down), to raise it back to
+func (hp *Hexapod) rememberStance(thermal *thermalMonitor) {
+	if thermal.raised {
+		return
+	}
+
+	thermal.raisedStance = hp.GetStance()
+	thermal.raised = true
+}
+
+// loweredHeight is how far the body drops from the given stance; no lower than the
+// legs reach, and never higher than it already is
+func (hp *Hexapod) loweredHeight(thermal *thermalMonitor, stance Stance) float64 {
+	height := math.Min(stance.Height, thermal.options.LowerHeight)
+	if minHeight, _, err := hp.GetHeightLimits(stance.Spread); err == nil {
+		height = math.Max(height, minHeight)
+	}
+
+	return height
+}
+
+// raiseBody puts the body back to the height it was at before it was lowered
+func (hp *Hexapod) raiseBody(thermal *thermalMonitor) {
+	if !thermal.raised {
+		return
+	}
+
+	thermal.raised = false
+	hp.SetBodyHeight(thermal.raisedStance.Height, thermal.options.MoveDuration)
+}
+
+// record works out the state from the latest temperatures; resting is only left once
+// every joint has cooled off, and then only as far as lowered (the body is raised
+// back up once nothing is projected to overheat either)
+func (tm *thermalMonitor) record(temperatures []JointTemperature) (ThermalState, JointTemperature) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	hottest := JointTemperature{}
+	for index, temperature := range temperatures {
+		if (index == 0) || (temperature.Projected > hottest.Projected) {
+			hottest = temperature
+		}
+	}
+
+	hottestNow := float32(0)
+	for _, temperature := range temperatures {
+		if temperature.Temperature > hottestNow {
+			hottestNow = temperature.Temperature
+		}
+	}
+
+	limit := tm.options.LimitTemperature
+	cool := limit - tm.options.Hysteresis
+
+	state := tm.state
+	switch {
+	case hottestNow >= limit:
+		state = ThermalResting
+	case state == ThermalResting:
+		if hottestNow <= cool {
+			state = ThermalLowered
+		}
+	case hottest.Projected >= limit:
+		state = ThermalLowered
+	case (state == ThermalUnknown) || (hottest.Projected <= cool):
+		state = ThermalNormal
+	}
+
+	tm.state = state
+	tm.hottest = hottest
+
+	return state, hottest
+}
+
+func (tm *thermalMonitor) getState() ThermalState {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	return tm.state
+}
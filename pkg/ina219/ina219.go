@@ -0,0 +1,168 @@
+package ina219
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/carldanley/hexapod/pkg/i2c"
+)
+
+const (
+	DefaultAddress = 0x40
+
+	// Taken from: https://www.ti.com/lit/ds/symlink/ina219.pdf
+	ConfigRegister       byte = 0x00
+	ShuntVoltageRegister byte = 0x01
+	BusVoltageRegister   byte = 0x02
+	PowerRegister        byte = 0x03
+	CurrentRegister      byte = 0x04
+	CalibrationRegister  byte = 0x05
+
+	// 32V bus range, /8 gain (320mV shunt range), 12-bit bus and shunt samples,
+	// shunt and bus voltages measured continuously
+	ConfigBusVoltageRange32V uint16 = 0x2000
+	ConfigGain320mV          uint16 = 0x1800
+	ConfigBusADC12Bit        uint16 = 0x0180
+	ConfigShuntADC12Bit      uint16 = 0x0018
+	ConfigModeContinuous     uint16 = 0x0007
+	ConfigReset              uint16 = 0x8000
+
+	BusVoltageLSB     float32 = 0.004   // 4mV
+	ShuntVoltageLSB   float32 = 0.00001 // 10uV
+	ShuntVoltageRange float32 = 0.32    // 320mV, from ConfigGain320mV
+
+	DefaultShuntResistance    float32 = 0.1 // 0.1 ohm
+	DefaultMaxExpectedCurrent float32 = 3.2 // 3.2A
+)
+
+type INA219 struct {
+	mutex       sync.Mutex
+	i2c         *i2c.Options
+	options     *Options
+	currentLSB  float32
+	calibration uint16
+}
+
+type Options struct {
+	ShuntResistance    float32
+	MaxExpectedCurrent float32
+}
+
+func New(i2c *i2c.Options, options *Options) (*INA219, error) {
+	address := i2c.GetAddr()
+	if address == 0 {
+		return nil, fmt.Errorf("I2C device is not initialized")
+	}
+
+	ina := &INA219{
+		i2c: i2c,
+		options: &Options{
+			ShuntResistance:    DefaultShuntResistance,
+			MaxExpectedCurrent: DefaultMaxExpectedCurrent,
+		},
+	}
+
+	if options != nil {
+		if (options.ShuntResistance <= 0) || (options.MaxExpectedCurrent <= 0) {
+			return nil, fmt.Errorf("invalid shunt resistance or max expected current")
+		}
+
+		ina.options = options
+	}
+
+	// work out the calibration value for the shunt we're using
+	ina.currentLSB = ina.options.MaxExpectedCurrent / 32768
+	calibration := math.Trunc(0.04096 / float64(ina.currentLSB*ina.options.ShuntResistance))
+	if calibration > math.MaxUint16 {
+		return nil, fmt.Errorf("INA219 cannot be calibrated for the given shunt")
+	}
+
+	ina.calibration = uint16(calibration)
+
+	config := ConfigBusVoltageRange32V | ConfigGain320mV | ConfigBusADC12Bit | ConfigShuntADC12Bit | ConfigModeContinuous
+	if err := ina.i2c.WriteRegU16BE(ConfigRegister, config); err != nil {
+		return nil, err
+	}
+
+	if err := ina.i2c.WriteRegU16BE(CalibrationRegister, ina.calibration); err != nil {
+		return nil, err
+	}
+
+	return ina, nil
+}
+
+func (ina *INA219) Reset() error {
+	return ina.i2c.WriteRegU16BE(ConfigRegister, ConfigReset)
+}
+
+// GetMaxCurrent returns the most current (in amps) the chip can report as configured,
+// which is the lower of what the shunt range and MaxExpectedCurrent allow; readings
+// saturate there however much current is really flowing
+func (ina *INA219) GetMaxCurrent() float32 {
+	shuntLimit := ShuntVoltageRange / ina.options.ShuntResistance
+	registerLimit := ina.currentLSB * math.MaxInt16
+
+	return float32(math.Min(float64(shuntLimit), float64(registerLimit)))
+}
+
+// GetBusVoltage returns the voltage on the load side of the shunt, in volts
+func (ina *INA219) GetBusVoltage() (float32, error) {
+	ina.mutex.Lock()
+	defer ina.mutex.Unlock()
+
+	raw, err := ina.i2c.ReadRegU16BE(BusVoltageRegister)
+	if err != nil {
+		return 0, err
+	}
+
+	return float32(raw>>3) * BusVoltageLSB, nil
+}
+
+// GetShuntVoltage returns the voltage across the shunt, in volts
+func (ina *INA219) GetShuntVoltage() (float32, error) {
+	ina.mutex.Lock()
+	defer ina.mutex.Unlock()
+
+	raw, err := ina.i2c.ReadRegS16BE(ShuntVoltageRegister)
+	if err != nil {
+		return 0, err
+	}
+
+	return float32(raw) * ShuntVoltageLSB, nil
+}
+
+// GetCurrent returns the current through the shunt, in amps
+func (ina *INA219) GetCurrent() (float32, error) {
+	ina.mutex.Lock()
+	defer ina.mutex.Unlock()
+
+	// a brown out can reset the chip, so write the calibration back every time
+	if err := ina.i2c.WriteRegU16BE(CalibrationRegister, ina.calibration); err != nil {
+		return 0, err
+	}
+
+	raw, err := ina.i2c.ReadRegS16BE(CurrentRegister)
+	if err != nil {
+		return 0, err
+	}
+
+	return float32(raw) * ina.currentLSB, nil
+}
+
+// GetPower returns the power being drawn, in watts
+func (ina *INA219) GetPower() (float32, error) {
+	ina.mutex.Lock()
+	defer ina.mutex.Unlock()
+
+	if err := ina.i2c.WriteRegU16BE(CalibrationRegister, ina.calibration); err != nil {
+		return 0, err
+	}
+
+	raw, err := ina.i2c.ReadRegU16BE(PowerRegister)
+	if err != nil {
+		return 0, err
+	}
+
+	return float32(raw) * ina.currentLSB * 20, nil
+}
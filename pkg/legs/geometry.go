@@ -0,0 +1,91 @@
+package legs
+
+import (
+	"math"
+
+	"github.com/carldanley/hexapod/pkg/geometry"
+)
+
+// LegGeometry describes a leg's links (in millimetres) and where it's mounted on the
+// body. The leg frame has its origin at the coxa joint, x pointing straight out along
+// the leg (with the coxa at 0) and z pointing up; Yaw is the angle (in degrees,
+// anticlockwise from the body's forward axis) the leg points out at.
+type LegGeometry struct {
+	CoxaLength  float64         `json:"coxaLength"`
+	FemurLength float64         `json:"femurLength"`
+	TibiaLength float64         `json:"tibiaLength"`
+	Position    geometry.Vector `json:"position"`
+	Yaw         float64         `json:"yaw"`
+}
+
+// WithGeometry returns a copy of the leg that knows its links and mounting
+func (l Leg) WithGeometry(legGeometry LegGeometry) Leg {
+	l.geometry = legGeometry
+	return l
+}
+
+func (l *Leg) GetGeometry() LegGeometry {
+	return l.geometry
+}
+
+// ForwardKinematics works out where the foot is for the given joint angles (using
+// the leg's convention), returning it in both the leg and body frames
+func (l *Leg) ForwardKinematics(coxa, femur, tibia float32) (geometry.Vector, geometry.Vector) {
+	footInLeg := l.geometry.footPosition(l.side, coxa, femur, tibia)
+	return footInLeg, l.geometry.LegToBody(footInLeg)
+}
+
+// GetFootPosition returns where the foot currently is, in the body frame
+func (l *Leg) GetFootPosition() geometry.Vector {
+	angles := l.GetAngles()
+	_, footInBody := l.ForwardKinematics(angles.Coxa, angles.Femur, angles.Tibia)
+
+	return footInBody
+}
+
+// JointPositions returns where the coxa, femur and tibia joints and the foot are (in
+// that order, in the body frame) for the given joint angles
+func (l *Leg) JointPositions(coxa, femur, tibia float32) []geometry.Vector {
+	swing := geometry.Radians(float64(l.side.swingAngle(coxa)))
+	femurAngle := geometry.Radians(float64(femur))
+
+	// the femur joint sits at the end of the coxa, the tibia joint at the end of the femur
+	femurJoint := geometry.Vector{X: l.geometry.CoxaLength}
+	tibiaJoint := geometry.Vector{
+		X: l.geometry.CoxaLength + l.geometry.FemurLength*math.Cos(femurAngle),
+		Z: l.geometry.FemurLength * math.Sin(femurAngle),
+	}
+
+	positions := []geometry.Vector{l.geometry.LegToBody(geometry.Vector{})}
+	for _, joint := range []geometry.Vector{femurJoint, tibiaJoint} {
+		positions = append(positions, l.geometry.LegToBody(joint.RotateZ(geometry.Degrees(swing))))
+	}
+
+	_, foot := l.ForwardKinematics(coxa, femur, tibia)
+	return append(positions, foot)
+}
+
+func (lg LegGeometry) LegToBody(point geometry.Vector) geometry.Vector {
+	return point.RotateZ(lg.Yaw).Add(lg.Position)
+}
+
+func (lg LegGeometry) BodyToLeg(point geometry.Vector) geometry.Vector {
+	return point.Sub(lg.Position).RotateZ(-lg.Yaw)
+}
+
+func (lg LegGeometry) footPosition(side Side, coxa, femur, tibia float32) geometry.Vector {
+	swing := geometry.Radians(float64(side.swingAngle(coxa)))
+
+	// the femur lifts up from horizontal and the tibia folds in (down) from the femur
+	femurAngle := geometry.Radians(float64(femur))
+	tibiaAngle := femurAngle - geometry.Radians(float64(tibia))
+
+	reach := lg.CoxaLength + lg.FemurLength*math.Cos(femurAngle) + lg.TibiaLength*math.Cos(tibiaAngle)
+	height := lg.FemurLength*math.Sin(femurAngle) + lg.TibiaLength*math.Sin(tibiaAngle)
+
+	return geometry.Vector{
+		X: reach * math.Cos(swing),
+		Y: reach * math.Sin(swing),
+		Z: height,
+	}
+}
@@ -0,0 +1,139 @@
+package legs
+
+import (
+	"math"
+	"testing"
+
+	"github.com/carldanley/hexapod/pkg/geometry"
+	"github.com/carldanley/hexapod/pkg/servos"
+)
+
+const (
+	positionTolerance = 1e-6
+	angleTolerance    = 1e-3
+)
+
+var testGeometry = LegGeometry{
+	CoxaLength:  52,
+	FemurLength: 82,
+	TibiaLength: 122,
+}
+
+// newTestLeg builds a leg whose servos can reach any angle the tests use; left legs
+// get inverted servos, as they are on the robot
+func newTestLeg(side Side, legGeometry LegGeometry) Leg {
+	servoType := servos.MustNewServoType(135, 538, 0, 270, -135, 135).WithInverted(side == Left)
+
+	return New(side,
+		servos.NewDetached(0, nil, servoType, 0),
+		servos.NewDetached(1, nil, servoType, 0),
+		servos.NewDetached(2, nil, servoType, 0),
+	).WithGeometry(legGeometry)
+}
+
+func closeTo(a, b geometry.Vector) bool {
+	return a.Sub(b).Length() <= positionTolerance
+}
+
+func TestForwardKinematicsKnownPoses(t *testing.T) {
+	reach := testGeometry.CoxaLength + testGeometry.FemurLength + testGeometry.TibiaLength
+	swing := geometry.Radians(30)
+
+	tests := []struct {
+		name   string
+		side   Side
+		angles JointAngles
+		want   geometry.Vector
+	}{
+		{"all zero", Right, JointAngles{}, geometry.Vector{X: reach}},
+		{"all zero left", Left, JointAngles{}, geometry.Vector{X: reach}},
+		{"femur up", Right, JointAngles{Femur: 90}, geometry.Vector{X: 52, Z: 82 + 122}},
+		{"femur down", Right, JointAngles{Femur: -90}, geometry.Vector{X: 52, Z: -(82 + 122)}},
+		{"tibia folded", Right, JointAngles{Tibia: 90}, geometry.Vector{X: 52 + 82, Z: -122}},
+		{"standing", Right, JointAngles{Femur: 90, Tibia: 90}, geometry.Vector{X: 52 + 122, Z: 82}},
+		{"coxa forward", Right, JointAngles{Coxa: 30}, geometry.Vector{X: reach * math.Cos(swing), Y: reach * math.Sin(swing)}},
+		{"coxa forward left", Left, JointAngles{Coxa: 30}, geometry.Vector{X: reach * math.Cos(swing), Y: -reach * math.Sin(swing)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			leg := newTestLeg(test.side, testGeometry)
+			footInLeg, footInBody := leg.ForwardKinematics(test.angles.Coxa, test.angles.Femur, test.angles.Tibia)
+
+			if !closeTo(footInLeg, test.want) {
+				t.Errorf("foot in leg frame = %s, want %s", footInLeg, test.want)
+			}
+
+			// with no mounting the two frames are the same
+			if !closeTo(footInBody, footInLeg) {
+				t.Errorf("foot in body frame = %s, want %s", footInBody, footInLeg)
+			}
+		})
+	}
+}
+
+func TestForwardKinematicsMounting(t *testing.T) {
+	mounted := testGeometry
+	mounted.Position = geometry.Vector{X: 60, Y: -40}
+	mounted.Yaw = -45
+
+	leg := newTestLeg(Right, mounted)
+	_, footInBody := leg.ForwardKinematics(0, 0, 0)
+
+	reach := testGeometry.CoxaLength + testGeometry.FemurLength + testGeometry.TibiaLength
+	want := geometry.Vector{
+		X: 60 + reach*math.Cos(geometry.Radians(-45)),
+		Y: -40 + reach*math.Sin(geometry.Radians(-45)),
+	}
+
+	if !closeTo(footInBody, want) {
+		t.Errorf("foot in body frame = %s, want %s", footInBody, want)
+	}
+}
+
+// TestKinematicsRoundTrip runs joint angles through forward and then inverse
+// kinematics, which should give the same angles back; the knee always points up, so
+// only positive tibia angles are used
+func TestKinematicsRoundTrip(t *testing.T) {
+	mounted := testGeometry
+	mounted.Position = geometry.Vector{X: 60, Y: 40}
+	mounted.Yaw = 45
+
+	for _, side := range []Side{Right, Left} {
+		t.Run(side.String(), func(t *testing.T) {
+			leg := newTestLeg(side, mounted)
+
+			for coxa := float32(-60); coxa <= 60; coxa += 15 {
+				for femur := float32(-30); femur <= 90; femur += 15 {
+					for tibia := float32(15); tibia <= 135; tibia += 15 {
+						_, foot := leg.ForwardKinematics(coxa, femur, tibia)
+
+						angles, err := leg.InverseKinematics(foot)
+						if err != nil {
+							t.Errorf("(%.0f, %.0f, %.0f) -> %s: %v", coxa, femur, tibia, foot, err)
+							continue
+						}
+
+						want := JointAngles{Coxa: coxa, Femur: femur, Tibia: tibia}
+						for _, joint := range Joints {
+							if math.Abs(float64(angles.Get(joint)-want.Get(joint))) > angleTolerance {
+								t.Errorf("(%.0f, %.0f, %.0f) -> %s -> %+v", coxa, femur, tibia, foot, angles)
+								break
+							}
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestInverseKinematicsUnreachable(t *testing.T) {
+	leg := newTestLeg(Right, testGeometry)
+
+	reach := testGeometry.CoxaLength + testGeometry.FemurLength + testGeometry.TibiaLength
+	_, err := leg.InverseKinematics(geometry.Vector{X: reach + 1})
+	if _, ok := err.(*UnreachableError); !ok {
+		t.Errorf("err = %v, want an UnreachableError", err)
+	}
+}
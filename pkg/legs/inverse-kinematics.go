@@ -0,0 +1,111 @@
+package legs
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/carldanley/hexapod/pkg/geometry"
+)
+
+// UnreachableError is returned when a foot position is too close to or too far
+// from the femur joint for the femur and tibia to reach
+type UnreachableError struct {
+	Point    geometry.Vector
+	Distance float64
+	MinReach float64
+	MaxReach float64
+}
+
+func (ue *UnreachableError) Error() string {
+	return fmt.Sprintf("foot position %s is unreachable: %.2fmm from the femur joint, reach is %.2fmm to %.2fmm", ue.Point, ue.Distance, ue.MinReach, ue.MaxReach)
+}
+
+// JointLimitError is returned when reaching a foot position would take a joint past
+// its servo's limits; angles use the leg's convention
+type JointLimitError struct {
+	Point geometry.Vector
+	Joint Joint
+	Angle float32
+	Min   float32
+	Max   float32
+}
+
+func (jle *JointLimitError) Error() string {
+	return fmt.Sprintf("foot position %s needs the %s at %.2f degrees, outside its limits of %.2f to %.2f", jle.Point, jle.Joint, jle.Angle, jle.Min, jle.Max)
+}
+
+// InverseKinematics works out the joint angles (using the leg's convention) that put
+// the foot at the given point in the body frame
+func (l *Leg) InverseKinematics(foot geometry.Vector) (JointAngles, error) {
+	angles, err := l.geometry.jointAngles(l.side, l.geometry.BodyToLeg(foot))
+	if err != nil {
+		if unreachable, ok := err.(*UnreachableError); ok {
+			unreachable.Point = foot
+		}
+
+		return JointAngles{}, err
+	}
+
+	minAngles, maxAngles := l.GetJointLimits()
+	for _, joint := range Joints {
+		angle := angles.Get(joint)
+		if (angle < minAngles.Get(joint)) || (angle > maxAngles.Get(joint)) {
+			return JointAngles{}, &JointLimitError{
+				Point: foot,
+				Joint: joint,
+				Angle: angle,
+				Min:   minAngles.Get(joint),
+				Max:   maxAngles.Get(joint),
+			}
+		}
+	}
+
+	return angles, nil
+}
+
+// MoveFootTo moves the foot to the given point in the body frame; nothing moves if
+// the point can't be reached
+func (l *Leg) MoveFootTo(foot geometry.Vector, duration time.Duration) error {
+	angles, err := l.InverseKinematics(foot)
+	if err != nil {
+		return err
+	}
+
+	l.MoveToJointAngles(angles, duration)
+	return nil
+}
+
+func (lg LegGeometry) jointAngles(side Side, footInLeg geometry.Vector) (JointAngles, error) {
+	if (lg.FemurLength <= 0) || (lg.TibiaLength <= 0) {
+		return JointAngles{}, fmt.Errorf("leg has no geometry")
+	}
+
+	swing := math.Atan2(footInLeg.Y, footInLeg.X)
+
+	// work in the plane the femur and tibia swing through, from the femur joint
+	reach := math.Hypot(footInLeg.X, footInLeg.Y) - lg.CoxaLength
+	height := footInLeg.Z
+	distance := math.Hypot(reach, height)
+
+	minReach := math.Abs(lg.FemurLength - lg.TibiaLength)
+	maxReach := lg.FemurLength + lg.TibiaLength
+	if (distance < minReach) || (distance > maxReach) {
+		return JointAngles{}, &UnreachableError{
+			Distance: distance,
+			MinReach: minReach,
+			MaxReach: maxReach,
+		}
+	}
+
+	// the knee always points up, so the tibia folds in by a positive angle
+	cosTibia := (distance*distance - lg.FemurLength*lg.FemurLength - lg.TibiaLength*lg.TibiaLength) / (2 * lg.FemurLength * lg.TibiaLength)
+	tibia := math.Acos(math.Max(-1, math.Min(1, cosTibia)))
+	femur := math.Atan2(height, reach) + math.Atan2(lg.TibiaLength*math.Sin(tibia), lg.FemurLength+lg.TibiaLength*math.Cos(tibia))
+
+	return JointAngles{
+		Coxa:  side.swingAngle(float32(geometry.Degrees(swing))),
+		Femur: float32(geometry.Degrees(femur)),
+		Tibia: float32(geometry.Degrees(tibia)),
+	}, nil
+}
@@ -1,31 +1,78 @@
 package legs
 
 import (
+	"sync"
 	"time"
 
 	"github.com/carldanley/hexapod/pkg/servos"
 )
 
 type Leg struct {
-	coxa  *servos.Servo
-	femur *servos.Servo
-	tibia *servos.Servo
+	side     Side
+	coxa     *servos.Servo
+	femur    *servos.Servo
+	tibia    *servos.Servo
+	geometry LegGeometry
+	driver   *legDriver
 }
 
-func New(coxa, femur, tibia *servos.Servo) Leg {
+// legDriver tracks the trajectory driving a leg; it's shared by every copy of the leg,
+// since legs are passed around by value
+type legDriver struct {
+	mutex      sync.Mutex
+	trajectory *Trajectory
+}
+
+// Snapshot is a point in time view of all three of a leg's servos
+type Snapshot struct {
+	Side   Side            `json:"side"`
+	Angles JointAngles     `json:"angles"`
+	Coxa   servos.Snapshot `json:"coxa"`
+	Femur  servos.Snapshot `json:"femur"`
+	Tibia  servos.Snapshot `json:"tibia"`
+	Moving bool            `json:"moving"`
+}
+
+func New(side Side, coxa, femur, tibia *servos.Servo) Leg {
 	return Leg{
-		coxa,
-		femur,
-		tibia,
+		side:   side,
+		coxa:   coxa,
+		femur:  femur,
+		tibia:  tibia,
+		driver: &legDriver{},
 	}
 }
 
+func (l *Leg) GetSide() Side {
+	return l.side
+}
+
 func (l *Leg) MoveToAngles(coxaAngle, femurAngle, tibiaAngle float32, duration time.Duration) {
 	l.MoveCoxaToAngle(coxaAngle, duration)
 	l.MoveFemurToAngle(femurAngle, duration)
 	l.MoveTibiaToAngle(tibiaAngle, duration)
 }
 
+func (l *Leg) MoveToJointAngles(angles JointAngles, duration time.Duration) {
+	l.MoveToAngles(angles.Coxa, angles.Femur, angles.Tibia, duration)
+}
+
+// MoveToJointAnglesAt is MoveToJointAngles with the move timed from startTime (see
+// servos.Servo.MoveToAngleAt)
+func (l *Leg) MoveToJointAnglesAt(angles JointAngles, startTime time.Time, duration time.Duration) {
+	l.coxa.MoveToAngleAt(angles.Coxa, startTime, duration)
+	l.femur.MoveToAngleAt(angles.Femur, startTime, duration)
+	l.tibia.MoveToAngleAt(angles.Tibia, startTime, duration)
+}
+
+// SetJointAnglesAt sends the joints straight to the angles as of now, for scheduler
+// tasks that move a leg a small step on every tick (the step is timed so it's already
+// finished when the servos are stepped later in the same tick)
+func (l *Leg) SetJointAnglesAt(angles JointAngles, now time.Time) {
+	step := time.Duration(servos.ServoMovementSpeedMS) * time.Millisecond
+	l.MoveToJointAnglesAt(angles, now.Add(-step), step)
+}
+
 func (l *Leg) MoveCoxaToAngle(angle float32, duration time.Duration) {
 	l.coxa.MoveToAngle(angle, duration)
 }
@@ -38,10 +85,124 @@ func (l *Leg) MoveTibiaToAngle(angle float32, duration time.Duration) {
 	l.tibia.MoveToAngle(angle, duration)
 }
 
+// GetAngles returns where the joints currently are, using the leg's convention
+func (l *Leg) GetAngles() JointAngles {
+	return JointAngles{
+		Coxa:  l.coxa.GetAngle(),
+		Femur: l.femur.GetAngle(),
+		Tibia: l.tibia.GetAngle(),
+	}
+}
+
+// GetTargetAngles returns where the joints are heading, using the leg's convention
+func (l *Leg) GetTargetAngles() JointAngles {
+	return JointAngles{
+		Coxa:  l.coxa.GetTarget(),
+		Femur: l.femur.GetTarget(),
+		Tibia: l.tibia.GetTarget(),
+	}
+}
+
+// GetJointLimits returns the lowest and highest angle each joint can reach, using
+// the leg's convention
+func (l *Leg) GetJointLimits() (JointAngles, JointAngles) {
+	coxaMin, coxaMax := l.servoLimits(l.coxa)
+	femurMin, femurMax := l.servoLimits(l.femur)
+	tibiaMin, tibiaMax := l.servoLimits(l.tibia)
+
+	return JointAngles{coxaMin, femurMin, tibiaMin}, JointAngles{coxaMax, femurMax, tibiaMax}
+}
+
+func (l *Leg) servoLimits(servo *servos.Servo) (float32, float32) {
+	servoType := servo.GetServoType()
+	return servoType.GetMinLimitAngle(), servoType.GetMaxLimitAngle()
+}
+
+// Detach lets all three joints go limp
+func (l *Leg) Detach() error {
+	for _, servo := range l.GetServos() {
+		if err := servo.Detach(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Attach powers the joints back up, ramping from where they're assumed to be (from)
+// to where they should end up (to)
+func (l *Leg) Attach(from, to JointAngles, ramp time.Duration) error {
+	if err := l.coxa.Attach(from.Coxa, to.Coxa, ramp); err != nil {
+		return err
+	}
+
+	if err := l.femur.Attach(from.Femur, to.Femur, ramp); err != nil {
+		return err
+	}
+
+	return l.tibia.Attach(from.Tibia, to.Tibia, ramp)
+}
+
+// SetHoldingLoad sets how much of a full load (0 to 1) every joint is holding up; a
+// foot on the ground carries its share of the body, one in the air next to nothing
+// (see servos.ThermalModel)
+func (l *Leg) SetHoldingLoad(load float32) {
+	for _, servo := range l.GetServos() {
+		servo.SetHoldingLoad(load)
+	}
+}
+
+// AttachJoint powers a single joint back up (see Attach)
+func (l *Leg) AttachJoint(joint Joint, from, to float32, ramp time.Duration) error {
+	return l.GetServo(joint).Attach(from, to, ramp)
+}
+
+func (l *Leg) IsAttached() bool {
+	return l.coxa.IsAttached() && l.femur.IsAttached() && l.tibia.IsAttached()
+}
+
+func (l *Leg) IsMoving() bool {
+	return l.coxa.IsMoving() || l.femur.IsMoving() || l.tibia.IsMoving()
+}
+
+func (l *Leg) GetSnapshot() Snapshot {
+	snapshot := Snapshot{
+		Side:  l.side,
+		Coxa:  l.coxa.GetSnapshot(),
+		Femur: l.femur.GetSnapshot(),
+		Tibia: l.tibia.GetSnapshot(),
+	}
+
+	snapshot.Angles = JointAngles{
+		Coxa:  snapshot.Coxa.Angle,
+		Femur: snapshot.Femur.Angle,
+		Tibia: snapshot.Tibia.Angle,
+	}
+
+	snapshot.Moving = snapshot.Coxa.Moving || snapshot.Femur.Moving || snapshot.Tibia.Moving
+
+	return snapshot
+}
+
+func (l *Leg) GetServo(joint Joint) *servos.Servo {
+	switch joint {
+	case Femur:
+		return l.femur
+	case Tibia:
+		return l.tibia
+	}
+
+	return l.coxa
+}
+
+func (l *Leg) GetServos() []*servos.Servo {
+	return []*servos.Servo{l.coxa, l.femur, l.tibia}
+}
+
 func (l *Leg) Start() {
-	go l.coxa.Start()
-	go l.femur.Start()
-	go l.tibia.Start()
+	l.coxa.Start()
+	l.femur.Start()
+	l.tibia.Start()
 }
 
 func (l *Leg) Stop() {
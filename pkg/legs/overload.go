@@ -0,0 +1,221 @@
+package legs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CurrentSensor measures the current drawn by the servos it sits in front of (ie - an
+// INA219); GetMaxCurrent is the full scale reading, beyond which readings saturate
+type CurrentSensor interface {
+	GetCurrent() (float32, error)
+	GetMaxCurrent() float32
+}
+
+// DefaultOverloadFraction is how far up the sensor's range the current has to get
+// to count as an overload when no threshold is given
+const DefaultOverloadFraction = 0.9
+
+type OverloadOptions struct {
+	// how often the current is checked
+	Interval time.Duration
+
+	// the current (in amps) that counts as an overload, and how long it has to last;
+	// the threshold has to be below the sensor's full scale, and is left at 0 to use
+	// DefaultOverloadFraction of it
+	Threshold float32
+	Duration  time.Duration
+
+	// if set, holding joints are eased back by up to this many degrees on an overload
+	BackOffAngle    float32
+	BackOffDuration time.Duration
+}
+
+var DefaultOverloadOptions = OverloadOptions{
+	Interval:        50 * time.Millisecond,
+	Threshold:       0,
+	Duration:        750 * time.Millisecond,
+	BackOffAngle:    0,
+	BackOffDuration: 250 * time.Millisecond,
+}
+
+type OverloadEvent struct {
+	Current   float32
+	Since     time.Time
+	BackedOff bool
+}
+
+// OverloadDetector watches the current drawn by a group of legs (one leg, or the whole
+// robot, depending on where the sensor sits) and raises an event when it stays too
+// high while the legs are meant to be holding still
+type OverloadDetector struct {
+	mutex           sync.Mutex
+	sensor          CurrentSensor
+	legs            []Leg
+	options         OverloadOptions
+	overloadedSince time.Time
+	raised          bool
+	lastCurrent     float32
+	stopWorkChannel chan bool
+	doneChannel     chan bool
+
+	// called (from the detector's goroutine) once per overload
+	OnOverload func(OverloadEvent)
+}
+
+func NewOverloadDetector(sensor CurrentSensor, legs []Leg, options *OverloadOptions) (*OverloadDetector, error) {
+	od := &OverloadDetector{
+		sensor:  sensor,
+		legs:    legs,
+		options: DefaultOverloadOptions,
+	}
+
+	if options != nil {
+		od.options = *options
+	}
+
+	if od.options.Interval <= 0 {
+		od.options.Interval = DefaultOverloadOptions.Interval
+	}
+
+	// a threshold the sensor can't read up to would never be crossed
+	maxCurrent := sensor.GetMaxCurrent()
+	if od.options.Threshold <= 0 {
+		od.options.Threshold = maxCurrent * DefaultOverloadFraction
+	} else if od.options.Threshold >= maxCurrent {
+		return nil, fmt.Errorf("overload threshold %.2fA is beyond the sensor's %.2fA full scale", od.options.Threshold, maxCurrent)
+	}
+
+	return od, nil
+}
+
+// GetThreshold returns the current (in amps) that counts as an overload
+func (od *OverloadDetector) GetThreshold() float32 {
+	return od.options.Threshold
+}
+
+func (od *OverloadDetector) GetLastCurrent() float32 {
+	od.mutex.Lock()
+	defer od.mutex.Unlock()
+
+	return od.lastCurrent
+}
+
+// Check takes a single reading, returning an event if this reading tipped the legs
+// into an overload
+func (od *OverloadDetector) Check(now time.Time) (OverloadEvent, bool, error) {
+	current, err := od.sensor.GetCurrent()
+	if err != nil {
+		return OverloadEvent{}, false, fmt.Errorf("could not read current: %w", err)
+	}
+
+	od.mutex.Lock()
+	defer od.mutex.Unlock()
+
+	od.lastCurrent = current
+
+	// the episode is only over once the current drops (backing off moves the legs,
+	// which mustn't count as recovering)
+	if current <= od.options.Threshold {
+		od.overloadedSince = time.Time{}
+		od.raised = false
+		return OverloadEvent{}, false, nil
+	}
+
+	// moving legs are expected to draw a lot, so only holding legs count
+	if od.isMoving() && !od.raised {
+		od.overloadedSince = time.Time{}
+		return OverloadEvent{}, false, nil
+	}
+
+	if od.overloadedSince.IsZero() {
+		od.overloadedSince = now
+	}
+
+	if od.raised || (now.Sub(od.overloadedSince) < od.options.Duration) {
+		return OverloadEvent{}, false, nil
+	}
+
+	od.raised = true
+
+	event := OverloadEvent{
+		Current: current,
+		Since:   od.overloadedSince,
+	}
+
+	if od.options.BackOffAngle > 0 {
+		for _, leg := range od.legs {
+			for _, servo := range leg.GetServos() {
+				servo.BackOff(od.options.BackOffAngle, od.options.BackOffDuration)
+			}
+		}
+
+		event.BackedOff = true
+	}
+
+	return event, true, nil
+}
+
+func (od *OverloadDetector) isMoving() bool {
+	for _, leg := range od.legs {
+		if leg.IsMoving() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Start checks the current from a goroutine until Stop is called; calling it on a
+// detector that is already running does nothing
+func (od *OverloadDetector) Start() {
+	od.mutex.Lock()
+	defer od.mutex.Unlock()
+
+	if od.stopWorkChannel != nil {
+		return
+	}
+
+	od.stopWorkChannel = make(chan bool)
+	od.doneChannel = make(chan bool)
+
+	go od.work(od.stopWorkChannel, od.doneChannel)
+}
+
+// Stop halts the detector's loop, waiting for it to finish; calling it on a detector
+// that isn't running does nothing
+func (od *OverloadDetector) Stop() {
+	od.mutex.Lock()
+	stopWorkChannel, doneChannel := od.stopWorkChannel, od.doneChannel
+	od.stopWorkChannel, od.doneChannel = nil, nil
+	od.mutex.Unlock()
+
+	if stopWorkChannel == nil {
+		return
+	}
+
+	close(stopWorkChannel)
+	<-doneChannel
+}
+
+func (od *OverloadDetector) work(stopWorkChannel, doneChannel chan bool) {
+	defer close(doneChannel)
+
+	ticker := time.NewTicker(od.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopWorkChannel:
+			return
+		case now := <-ticker.C:
+			// a failed read just gets tried again on the next tick
+			event, overloaded, _ := od.Check(now)
+
+			if overloaded && (od.OnOverload != nil) {
+				od.OnOverload(event)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package legs
+
+import "fmt"
+
+// Side is which side of the body a leg is mounted on. A leg's angles always mean the
+// same thing: a positive coxa angle swings the foot forward, a positive femur angle
+// lifts the femur and a positive tibia angle folds the tibia in. Left legs are mounted
+// as a mirror image of the right legs, so their servos need to turn the other way to
+// match, which is down to their servo types (see servos.ServoType.WithInverted); the
+// side only decides which way forward is when working out where the foot is.
+type Side int
+
+const (
+	Right Side = iota
+	Left
+)
+
+func (s Side) String() string {
+	switch s {
+	case Right:
+		return "right"
+	case Left:
+		return "left"
+	}
+
+	return fmt.Sprintf("Side(%d)", int(s))
+}
+
+func (s Side) MarshalText() ([]byte, error) {
+	if (s != Right) && (s != Left) {
+		return nil, fmt.Errorf("invalid side: %d", int(s))
+	}
+
+	return []byte(s.String()), nil
+}
+
+func (s *Side) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "right":
+		*s = Right
+	case "left":
+		*s = Left
+	default:
+		return fmt.Errorf("invalid side: %s", text)
+	}
+
+	return nil
+}
+
+// swingAngle converts a coxa angle into how far the leg has turned anticlockwise
+// (seen from above), and back again since it's its own inverse; swinging the foot
+// forward turns a right leg anticlockwise but a left leg clockwise
+func (s Side) swingAngle(coxa float32) float32 {
+	if s == Left {
+		return -coxa
+	}
+
+	return coxa
+}
+
+// JointAngles are a leg's angles using the leg's convention (see Side)
+type JointAngles struct {
+	Coxa  float32 `json:"coxa"`
+	Femur float32 `json:"femur"`
+	Tibia float32 `json:"tibia"`
+}
+
+// Joint picks out one of a leg's three joints
+type Joint int
+
+const (
+	Coxa Joint = iota
+	Femur
+	Tibia
+)
+
+var Joints = []Joint{Coxa, Femur, Tibia}
+
+func (j Joint) String() string {
+	switch j {
+	case Coxa:
+		return "coxa"
+	case Femur:
+		return "femur"
+	case Tibia:
+		return "tibia"
+	}
+
+	return fmt.Sprintf("Joint(%d)", int(j))
+}
+
+func (j Joint) MarshalText() ([]byte, error) {
+	return []byte(j.String()), nil
+}
+
+func (ja JointAngles) Get(joint Joint) float32 {
+	switch joint {
+	case Femur:
+		return ja.Femur
+	case Tibia:
+		return ja.Tibia
+	}
+
+	return ja.Coxa
+}
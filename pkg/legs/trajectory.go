@@ -0,0 +1,229 @@
+package legs
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/carldanley/hexapod/pkg/easings"
+	"github.com/carldanley/hexapod/pkg/geometry"
+	"github.com/carldanley/hexapod/pkg/servos"
+)
+
+// how many points along a path are checked before a trajectory starts
+const trajectoryCheckPoints = 32
+
+// Path is a curve for the foot to follow in the body frame, from progress 0 to 1
+type Path interface {
+	PointAt(progress float64) geometry.Vector
+}
+
+// Line is a straight path between two points
+type Line struct {
+	From geometry.Vector
+	To   geometry.Vector
+}
+
+func (line Line) PointAt(progress float64) geometry.Vector {
+	return line.From.Add(line.To.Sub(line.From).Scale(progress))
+}
+
+// CubicBezier is a curved path from Start to End, pulled towards the two control
+// points (ie - lifting a foot up and over something)
+type CubicBezier struct {
+	Start    geometry.Vector
+	Control1 geometry.Vector
+	Control2 geometry.Vector
+	End      geometry.Vector
+}
+
+func (cb CubicBezier) PointAt(progress float64) geometry.Vector {
+	remaining := 1 - progress
+
+	return cb.Start.Scale(remaining * remaining * remaining).
+		Add(cb.Control1.Scale(3 * remaining * remaining * progress)).
+		Add(cb.Control2.Scale(3 * remaining * progress * progress)).
+		Add(cb.End.Scale(progress * progress * progress))
+}
+
+// Step is the path a walking foot takes: lifting off at From, easing over to To and
+// reaching Height above the straight line between them halfway
+type Step struct {
+	From   geometry.Vector
+	To     geometry.Vector
+	Height float64
+}
+
+func (step Step) PointAt(progress float64) geometry.Vector {
+	along := float64(easings.SineInOut(float32(progress), 0, 1, 1))
+
+	point := step.From.Add(step.To.Sub(step.From).Scale(along))
+	point.Z += step.Height * math.Sin(math.Pi*progress)
+
+	return point
+}
+
+// Trajectory moves a foot along a path, solving the inverse kinematics on every
+// scheduler tick so the foot follows the path itself rather than the arc joint
+// interpolation would trace.
+type Trajectory struct {
+	mutex     sync.Mutex
+	leg       *Leg
+	driver    *legDriver
+	path      Path
+	offset    geometry.Vector
+	duration  time.Duration
+	easing    easings.Func
+	startTime time.Time
+	cancelled bool
+	err       error
+	done      chan bool
+}
+
+// FollowPath starts moving the foot along the path, taking duration with the named
+// easing (ie - "SineInOut") setting the pace along it. The foot starts from wherever
+// it is, easing onto the path by the end if the path starts somewhere else. The path
+// is checked before anything moves, so an unreachable path returns an
+// UnreachableError or JointLimitError. Only one trajectory drives a leg at a time, so
+// any trajectory already driving it is cancelled.
+func (l *Leg) FollowPath(scheduler *servos.Scheduler, path Path, duration time.Duration, easingName string) (*Trajectory, error) {
+	easing, ok := easings.Lookup(easingName)
+	if !ok {
+		return nil, fmt.Errorf("unknown easing: %s", easingName)
+	}
+
+	if duration <= 0 {
+		return nil, fmt.Errorf("duration must be positive")
+	}
+
+	trajectory := &Trajectory{
+		leg:      l,
+		driver:   l.driver,
+		path:     path,
+		offset:   l.GetFootPosition().Sub(path.PointAt(0)),
+		duration: duration,
+		easing:   easing,
+		done:     make(chan bool),
+	}
+
+	for i := 0; i <= trajectoryCheckPoints; i++ {
+		if _, err := l.InverseKinematics(trajectory.pointAt(float64(i) / trajectoryCheckPoints)); err != nil {
+			return nil, err
+		}
+	}
+
+	l.driver.mutex.Lock()
+	previous := l.driver.trajectory
+	l.driver.trajectory = trajectory
+	l.driver.mutex.Unlock()
+
+	if previous != nil {
+		previous.Cancel()
+	}
+
+	scheduler.AddTask(trajectory)
+
+	return trajectory, nil
+}
+
+// CancelPath stops whichever trajectory is driving the leg, leaving the foot where it
+// got to
+func (l *Leg) CancelPath() {
+	l.driver.mutex.Lock()
+	trajectory := l.driver.trajectory
+	l.driver.mutex.Unlock()
+
+	if trajectory != nil {
+		trajectory.Cancel()
+	}
+}
+
+// Tick puts the joints wherever the foot should be at this tick
+func (t *Trajectory) Tick(now time.Time) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.cancelled || (t.err != nil) {
+		return false
+	}
+
+	if t.startTime.IsZero() {
+		t.startTime = now
+	}
+
+	elapsed := now.Sub(t.startTime)
+	progress := float32(1)
+	if elapsed < t.duration {
+		progress = t.easing(float32(elapsed.Seconds()), 0, 1, float32(t.duration.Seconds()))
+	}
+
+	angles, err := t.leg.InverseKinematics(t.pointAt(float64(progress)))
+	if err != nil {
+		// an overshooting easing can still carry the foot out of reach
+		t.finish(err)
+		return false
+	}
+
+	t.leg.SetJointAnglesAt(angles, now)
+
+	if elapsed >= t.duration {
+		t.finish(nil)
+		return false
+	}
+
+	return true
+}
+
+// pointAt is where the foot should be at the given progress; the gap between where
+// the foot started and the start of the path closes as it goes
+func (t *Trajectory) pointAt(progress float64) geometry.Vector {
+	return t.path.PointAt(progress).Add(t.offset.Scale(1 - progress))
+}
+
+// Cancel stops the trajectory where it is
+func (t *Trajectory) Cancel() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.isDone() {
+		t.cancelled = true
+		t.release()
+		close(t.done)
+	}
+}
+
+// Wait blocks until the trajectory finishes, returning why it stopped early (if it did)
+func (t *Trajectory) Wait() error {
+	<-t.done
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.err
+}
+
+func (t *Trajectory) finish(err error) {
+	t.err = err
+	t.release()
+	close(t.done)
+}
+
+// release lets go of the leg, unless another trajectory has already taken it over
+func (t *Trajectory) release() {
+	t.driver.mutex.Lock()
+	defer t.driver.mutex.Unlock()
+
+	if t.driver.trajectory == t {
+		t.driver.trajectory = nil
+	}
+}
+
+func (t *Trajectory) isDone() bool {
+	select {
+	case <-t.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,93 @@
+package legs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carldanley/hexapod/pkg/geometry"
+	"github.com/carldanley/hexapod/pkg/servos"
+)
+
+// targets are read back through a whole pwm, which moves the foot a couple of
+// millimetres; the path starts much further than that from the foot
+const footTolerance = 3
+
+func targetFoot(leg Leg) geometry.Vector {
+	angles := leg.GetTargetAngles()
+	_, foot := leg.ForwardKinematics(angles.Coxa, angles.Femur, angles.Tibia)
+
+	return foot
+}
+
+func TestTrajectoryStartsFromFoot(t *testing.T) {
+	leg := newTestLeg(Right, testGeometry)
+	pose := JointAngles{Femur: 30, Tibia: 90}
+	if err := leg.Attach(pose, pose, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	start := leg.GetFootPosition()
+	path := Line{
+		From: geometry.Vector{X: 150, Y: -20, Z: -60},
+		To:   geometry.Vector{X: 150, Y: 20, Z: -60},
+	}
+
+	scheduler := servos.NewScheduler(time.Millisecond)
+	trajectory, err := leg.FollowPath(scheduler, path, time.Second, "LinearNone")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	// the foot mustn't jump to the start of the path on the first tick
+	trajectory.Tick(now)
+	if foot := targetFoot(leg); foot.Sub(start).Length() > footTolerance {
+		t.Errorf("first tick put the foot at %s, want %s", foot, start)
+	}
+
+	// but it ends up at the end of the path
+	trajectory.Tick(now.Add(time.Second))
+	if foot := targetFoot(leg); foot.Sub(path.To).Length() > footTolerance {
+		t.Errorf("last tick put the foot at %s, want %s", foot, path.To)
+	}
+
+	if err := trajectory.Wait(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFollowPathCancelsPreviousTrajectory(t *testing.T) {
+	leg := newTestLeg(Right, testGeometry)
+	pose := JointAngles{Femur: 30, Tibia: 90}
+	if err := leg.Attach(pose, pose, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	path := Line{
+		From: geometry.Vector{X: 150, Y: -20, Z: -60},
+		To:   geometry.Vector{X: 150, Y: 20, Z: -60},
+	}
+
+	scheduler := servos.NewScheduler(time.Millisecond)
+	first, err := leg.FollowPath(scheduler, path, time.Second, "LinearNone")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a copy of the leg is still the same leg
+	copied := leg
+	second, err := copied.FollowPath(scheduler, path, time.Second, "LinearNone")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Tick(time.Now()) {
+		t.Error("the first trajectory kept going after the second took over")
+	}
+
+	leg.CancelPath()
+	if second.Tick(time.Now()) {
+		t.Error("the second trajectory kept going after being cancelled")
+	}
+}
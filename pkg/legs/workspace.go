@@ -0,0 +1,174 @@
+package legs
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/carldanley/hexapod/pkg/geometry"
+)
+
+const DefaultWorkspaceResolution = 10 // millimetres
+
+type voxel struct {
+	x, y, z int
+}
+
+// Workspace is a voxel model of everywhere a leg's foot can reach (in the body
+// frame), built by sampling every joint within its servo's limits
+type Workspace struct {
+	resolution float64
+	voxels     map[voxel]bool
+}
+
+// BuildWorkspace samples the joint space finely enough that no voxel (resolution
+// millimetres a side) the foot can reach is skipped over
+func (l *Leg) BuildWorkspace(resolution float64) (*Workspace, error) {
+	if resolution <= 0 {
+		return nil, fmt.Errorf("resolution must be positive")
+	}
+
+	if (l.geometry.FemurLength <= 0) || (l.geometry.TibiaLength <= 0) {
+		return nil, fmt.Errorf("leg has no geometry")
+	}
+
+	// a joint step moves the foot by at most step * radius, so keep that under half
+	// a voxel for the longest radius each joint swings the foot through
+	reach := l.geometry.CoxaLength + l.geometry.FemurLength + l.geometry.TibiaLength
+	coxaStep := sampleStep(resolution, reach)
+	femurStep := sampleStep(resolution, l.geometry.FemurLength+l.geometry.TibiaLength)
+	tibiaStep := sampleStep(resolution, l.geometry.TibiaLength)
+
+	workspace := &Workspace{
+		resolution: resolution,
+		voxels:     map[voxel]bool{},
+	}
+
+	minAngles, maxAngles := l.GetJointLimits()
+	for _, coxa := range sampleRange(minAngles.Coxa, maxAngles.Coxa, coxaStep) {
+		for _, femur := range sampleRange(minAngles.Femur, maxAngles.Femur, femurStep) {
+			for _, tibia := range sampleRange(minAngles.Tibia, maxAngles.Tibia, tibiaStep) {
+				_, foot := l.ForwardKinematics(coxa, femur, tibia)
+				workspace.voxels[workspace.voxelAt(foot)] = true
+			}
+		}
+	}
+
+	return workspace, nil
+}
+
+// sampleStep returns the joint step (in degrees) that moves a point radius away by
+// half of resolution
+func sampleStep(resolution, radius float64) float32 {
+	return float32(geometry.Degrees(resolution / 2 / radius))
+}
+
+func sampleRange(lowest, highest, step float32) []float32 {
+	samples := []float32{}
+	for angle := lowest; angle < highest; angle += step {
+		samples = append(samples, angle)
+	}
+
+	return append(samples, highest)
+}
+
+func (w *Workspace) voxelAt(point geometry.Vector) voxel {
+	return voxel{
+		x: int(math.Floor(point.X / w.resolution)),
+		y: int(math.Floor(point.Y / w.resolution)),
+		z: int(math.Floor(point.Z / w.resolution)),
+	}
+}
+
+func (w *Workspace) voxelCenter(v voxel) geometry.Vector {
+	return geometry.Vector{
+		X: (float64(v.x) + 0.5) * w.resolution,
+		Y: (float64(v.y) + 0.5) * w.resolution,
+		Z: (float64(v.z) + 0.5) * w.resolution,
+	}
+}
+
+func (w *Workspace) GetResolution() float64 {
+	return w.resolution
+}
+
+// Contains reports whether the foot can reach the point (to within a voxel)
+func (w *Workspace) Contains(point geometry.Vector) bool {
+	return w.voxels[w.voxelAt(point)]
+}
+
+// GetPoints returns the centre of every reachable voxel, ordered by height then x then y
+func (w *Workspace) GetPoints() []geometry.Vector {
+	voxels := []voxel{}
+	for v := range w.voxels {
+		voxels = append(voxels, v)
+	}
+
+	sort.Slice(voxels, func(i, j int) bool {
+		if voxels[i].z != voxels[j].z {
+			return voxels[i].z < voxels[j].z
+		}
+
+		if voxels[i].x != voxels[j].x {
+			return voxels[i].x < voxels[j].x
+		}
+
+		return voxels[i].y < voxels[j].y
+	})
+
+	points := []geometry.Vector{}
+	for _, v := range voxels {
+		points = append(points, w.voxelCenter(v))
+	}
+
+	return points
+}
+
+// GetSlice returns the centre of every reachable voxel at the given height
+func (w *Workspace) GetSlice(height float64) []geometry.Vector {
+	z := int(math.Floor(height / w.resolution))
+
+	points := []geometry.Vector{}
+	for _, point := range w.GetPoints() {
+		if w.voxelAt(point).z == z {
+			points = append(points, point)
+		}
+	}
+
+	return points
+}
+
+// MaxStride returns the longest stride (in millimetres) the foot can take through
+// neutral, heading degrees anticlockwise from forward, with the foot at the given
+// height; the stride is centred on neutral, so it's limited by the shorter side
+func (w *Workspace) MaxStride(height float64, neutral geometry.Vector, heading float64) float64 {
+	neutral.Z = height
+	if !w.Contains(neutral) {
+		return 0
+	}
+
+	direction := geometry.Vector{X: 1}.RotateZ(heading)
+	forward := w.reachAlong(neutral, direction)
+	backward := w.reachAlong(neutral, direction.Scale(-1))
+
+	return 2 * math.Min(forward, backward)
+}
+
+// reachAlong walks from start in direction until the foot can't reach any further
+func (w *Workspace) reachAlong(start, direction geometry.Vector) float64 {
+	step := w.resolution / 2
+
+	distance := 0.0
+	for w.Contains(start.Add(direction.Scale(distance + step))) {
+		distance += step
+	}
+
+	return distance
+}
+
+// IsReachable reports exactly (rather than to within a voxel) whether the foot can
+// be put at the point in the body frame
+func (l *Leg) IsReachable(foot geometry.Vector) bool {
+	_, err := l.InverseKinematics(foot)
+	return err == nil
+}
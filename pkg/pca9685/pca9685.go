@@ -166,6 +166,30 @@ func (pca *PCA9685) SetPWM(channel, on, off int) error {
 	return err
 }
 
+// SetPWMs writes consecutive channels (starting at channel) in a single i2c
+// transaction, relying on the auto increment mode enabled by SetOscillatorFrequency
+func (pca *PCA9685) SetPWMs(channel, on int, offs []int) error {
+	if (channel < 0) || (channel+len(offs) > 16) {
+		return fmt.Errorf("invalid channel value")
+	}
+
+	if (on < 0) || (on > int(StepCount)) {
+		return fmt.Errorf("invalid on value")
+	}
+
+	buffer := []byte{Led0OnLow + byte(4*channel)}
+	for _, off := range offs {
+		if (off < 0) || (off > int(StepCount)) {
+			return fmt.Errorf("invalid off value")
+		}
+
+		buffer = append(buffer, byte(on), byte(on>>8), byte(off), byte(off>>8))
+	}
+
+	_, err := pca.i2c.WriteBytes(buffer)
+	return err
+}
+
 func (pca *PCA9685) GetPWM(channel int, off bool) (int, error) {
 	addressByte := byte(Led0OnLow + byte(4*channel))
 
@@ -0,0 +1,198 @@
+package servos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DefaultCalibrationPath is where the calibrate command writes to and the hexapod
+// reads from unless told otherwise
+const DefaultCalibrationPath = "calibration.json"
+
+// Calibration holds the trims and limits for every servo on the robot, keyed by
+// servo name (ie - "RightLeg1_Coxa"), so recalibrating doesn't mean recompiling
+type Calibration struct {
+	Servos map[string]ServoCalibration `json:"servos"`
+}
+
+// ServoCalibration is the on-disk form of a ServoType; limit angles are as seen by
+// the servo itself (before any inversion is applied)
+type ServoCalibration struct {
+	MinHardwarePWM   int                `json:"minHardwarePWM"`
+	MaxHardwarePWM   int                `json:"maxHardwarePWM"`
+	MaxHardwareAngle float32            `json:"maxHardwareAngle"`
+	CenterPWMOffset  int                `json:"centerPWMOffset"`
+	MinLimitAngle    float32            `json:"minLimitAngle"`
+	MaxLimitAngle    float32            `json:"maxLimitAngle"`
+	Inverted         bool               `json:"inverted"`
+	CalibrationTable []CalibrationPoint `json:"calibrationTable,omitempty"`
+	Interpolation    Interpolation      `json:"interpolation,omitempty"`
+	Feedback         *FeedbackMapping   `json:"feedback,omitempty"`
+}
+
+func NewCalibration() *Calibration {
+	return &Calibration{
+		Servos: map[string]ServoCalibration{},
+	}
+}
+
+// DefaultCalibration is built from the servo types declared in servo-types.go
+func DefaultCalibration() *Calibration {
+	calibration := NewCalibration()
+
+	for name, st := range map[string]ServoType{
+		"RightLeg1_Coxa":  ServoType_RightLeg1_Coxa,
+		"RightLeg1_Femur": ServoType_RightLeg1_Femur,
+		"RightLeg1_Tibia": ServoType_RightLeg1_Tibia,
+		"RightLeg2_Coxa":  ServoType_RightLeg2_Coxa,
+		"RightLeg2_Femur": ServoType_RightLeg2_Femur,
+		"RightLeg2_Tibia": ServoType_RightLeg2_Tibia,
+		"RightLeg3_Coxa":  ServoType_RightLeg3_Coxa,
+		"RightLeg3_Femur": ServoType_RightLeg3_Femur,
+		"RightLeg3_Tibia": ServoType_RightLeg3_Tibia,
+		"LeftLeg1_Coxa":   ServoType_LeftLeg1_Coxa,
+		"LeftLeg1_Femur":  ServoType_LeftLeg1_Femur,
+		"LeftLeg1_Tibia":  ServoType_LeftLeg1_Tibia,
+		"LeftLeg2_Coxa":   ServoType_LeftLeg2_Coxa,
+		"LeftLeg2_Femur":  ServoType_LeftLeg2_Femur,
+		"LeftLeg2_Tibia":  ServoType_LeftLeg2_Tibia,
+		"LeftLeg3_Coxa":   ServoType_LeftLeg3_Coxa,
+		"LeftLeg3_Femur":  ServoType_LeftLeg3_Femur,
+		"LeftLeg3_Tibia":  ServoType_LeftLeg3_Tibia,
+	} {
+		calibration.SetServoType(name, st)
+	}
+
+	return calibration
+}
+
+func LoadCalibration(path string) (*Calibration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	calibration := NewCalibration()
+	if err := json.Unmarshal(data, calibration); err != nil {
+		return nil, fmt.Errorf("could not parse calibration file %s: %w", path, err)
+	}
+
+	// make sure everything in the file actually describes a usable servo
+	for _, name := range calibration.GetServoNames() {
+		if _, err := calibration.GetServoType(name); err != nil {
+			return nil, fmt.Errorf("invalid calibration for %s: %w", name, err)
+		}
+	}
+
+	return calibration, nil
+}
+
+// LoadCalibrationOrDefault is LoadCalibration, except a missing file falls back to
+// DefaultCalibration; the returned bool says whether the file was actually read
+func LoadCalibrationOrDefault(path string) (*Calibration, bool, error) {
+	calibration, err := LoadCalibration(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return DefaultCalibration(), false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return calibration, true, nil
+}
+
+// Save writes the calibration out to a temporary file first so a failed write never
+// leaves a half written calibration behind
+func (c *Calibration) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temporaryFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(temporaryFile.Name())
+
+	if _, err := temporaryFile.Write(append(data, '\n')); err != nil {
+		temporaryFile.Close()
+		return err
+	}
+
+	if err := temporaryFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temporaryFile.Name(), path)
+}
+
+func (c *Calibration) GetServoNames() []string {
+	names := []string{}
+	for name := range c.Servos {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func (c *Calibration) GetServoType(name string) (ServoType, error) {
+	servoCalibration, ok := c.Servos[name]
+	if !ok {
+		return ServoType{}, fmt.Errorf("no calibration for servo: %s", name)
+	}
+
+	return servoCalibration.ServoType()
+}
+
+func (c *Calibration) SetServoType(name string, st ServoType) {
+	c.Servos[name] = NewServoCalibration(st)
+}
+
+func NewServoCalibration(st ServoType) ServoCalibration {
+	table, interpolation := st.GetCalibrationTable()
+
+	servoCalibration := ServoCalibration{
+		MinHardwarePWM:   st.minHardwarePWM,
+		MaxHardwarePWM:   st.maxHardwarePWM,
+		MaxHardwareAngle: st.maxHardwareAngle,
+		CenterPWMOffset:  st.centerPWMOffset,
+		MinLimitAngle:    st.minLimitAngle,
+		MaxLimitAngle:    st.maxLimitAngle,
+		Inverted:         st.inverted,
+		CalibrationTable: table,
+		Interpolation:    interpolation,
+	}
+
+	if mapping, ok := st.GetFeedbackMapping(); ok {
+		servoCalibration.Feedback = &mapping
+	}
+
+	return servoCalibration
+}
+
+func (sc ServoCalibration) ServoType() (ServoType, error) {
+	st, err := NewServoType(sc.MinHardwarePWM, sc.MaxHardwarePWM, sc.CenterPWMOffset, sc.MaxHardwareAngle, sc.MinLimitAngle, sc.MaxLimitAngle)
+	if err != nil {
+		return ServoType{}, err
+	}
+
+	if len(sc.CalibrationTable) > 0 {
+		if st, err = st.WithCalibrationTable(sc.CalibrationTable, sc.Interpolation); err != nil {
+			return ServoType{}, err
+		}
+	}
+
+	if sc.Feedback != nil {
+		if st, err = st.WithFeedback(*sc.Feedback); err != nil {
+			return ServoType{}, err
+		}
+	}
+
+	return st.WithInverted(sc.Inverted), nil
+}
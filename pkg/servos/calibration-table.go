@@ -0,0 +1,246 @@
+package servos
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+type Interpolation int
+
+const (
+	InterpolationLinear Interpolation = iota
+	InterpolationSpline
+)
+
+var interpolationNames = map[Interpolation]string{
+	InterpolationLinear: "linear",
+	InterpolationSpline: "spline",
+}
+
+func (i Interpolation) String() string {
+	if name, ok := interpolationNames[i]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Interpolation(%d)", int(i))
+}
+
+func (i Interpolation) MarshalText() ([]byte, error) {
+	if _, ok := interpolationNames[i]; !ok {
+		return nil, fmt.Errorf("invalid interpolation: %d", int(i))
+	}
+
+	return []byte(i.String()), nil
+}
+
+func (i *Interpolation) UnmarshalText(text []byte) error {
+	for interpolation, name := range interpolationNames {
+		if name == string(text) {
+			*i = interpolation
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid interpolation: %s", text)
+}
+
+// CalibrationPoint is a measured pwm for a given servo angle
+type CalibrationPoint struct {
+	Angle float32 `json:"angle"`
+	PWM   float32 `json:"pwm"`
+}
+
+// calibrationTable maps angles to pwms (and back) through measured points rather than
+// assuming the servo is linear across its whole range
+type calibrationTable struct {
+	points        []CalibrationPoint
+	interpolation Interpolation
+
+	// tangents for the spline, one per point
+	tangents []float64
+}
+
+// WithCalibrationTable returns a copy of the servo type that converts angles through
+// the measured points; limits are pulled in to the range the table covers
+func (st ServoType) WithCalibrationTable(points []CalibrationPoint, interpolation Interpolation) (ServoType, error) {
+	table, err := newCalibrationTable(points, interpolation)
+	if err != nil {
+		return ServoType{}, err
+	}
+
+	for _, point := range table.points {
+		if (point.PWM < float32(st.minHardwarePWM)) || (point.PWM > float32(st.maxHardwarePWM)) {
+			return ServoType{}, fmt.Errorf("calibration pwm %f is outside of the hardware range", point.PWM)
+		}
+	}
+
+	first, last := table.points[0], table.points[len(table.points)-1]
+	if (st.maxLimitAngle <= first.Angle) || (st.minLimitAngle >= last.Angle) {
+		return ServoType{}, fmt.Errorf("calibration table (%f to %f) doesn't cover the limit angles", first.Angle, last.Angle)
+	}
+
+	st.calibration = table
+
+	// only allow angles the table can describe
+	st.minLimitAngle = float32(math.Max(float64(st.minLimitAngle), float64(first.Angle)))
+	st.maxLimitAngle = float32(math.Min(float64(st.maxLimitAngle), float64(last.Angle)))
+
+	st.minLimitPWM = table.angleToPWM(st.minLimitAngle)
+	st.maxLimitPWM = table.angleToPWM(st.maxLimitAngle)
+	st.centerLimitPWM = table.angleToPWM(0)
+
+	return st, nil
+}
+
+func (st *ServoType) GetCalibrationTable() ([]CalibrationPoint, Interpolation) {
+	if st.calibration == nil {
+		return nil, InterpolationLinear
+	}
+
+	return append([]CalibrationPoint{}, st.calibration.points...), st.calibration.interpolation
+}
+
+func newCalibrationTable(points []CalibrationPoint, interpolation Interpolation) (*calibrationTable, error) {
+	if len(points) < 2 {
+		return nil, fmt.Errorf("a calibration table needs at least 2 points")
+	}
+
+	if (interpolation != InterpolationLinear) && (interpolation != InterpolationSpline) {
+		return nil, fmt.Errorf("invalid interpolation: %d", interpolation)
+	}
+
+	sorted := append([]CalibrationPoint{}, points...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Angle < sorted[j].Angle
+	})
+
+	// the pwm has to keep climbing with the angle, otherwise we can't convert back
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Angle == sorted[i-1].Angle {
+			return nil, fmt.Errorf("duplicate calibration angle: %f", sorted[i].Angle)
+		}
+
+		if sorted[i].PWM <= sorted[i-1].PWM {
+			return nil, fmt.Errorf("calibration pwm must increase with angle (%f at %f)", sorted[i].PWM, sorted[i].Angle)
+		}
+	}
+
+	table := &calibrationTable{
+		points:        sorted,
+		interpolation: interpolation,
+	}
+
+	if interpolation == InterpolationSpline {
+		table.tangents = monotoneTangents(sorted)
+	}
+
+	return table, nil
+}
+
+// monotoneTangents works out Fritsch-Carlson tangents so the spline never overshoots
+// between points and stays invertible
+func monotoneTangents(points []CalibrationPoint) []float64 {
+	count := len(points)
+	secants := make([]float64, count-1)
+	for i := 0; i < count-1; i++ {
+		secants[i] = float64(points[i+1].PWM-points[i].PWM) / float64(points[i+1].Angle-points[i].Angle)
+	}
+
+	tangents := make([]float64, count)
+	tangents[0] = secants[0]
+	tangents[count-1] = secants[count-2]
+	for i := 1; i < count-1; i++ {
+		tangents[i] = (secants[i-1] + secants[i]) / 2
+	}
+
+	for i := 0; i < count-1; i++ {
+		alpha := tangents[i] / secants[i]
+		beta := tangents[i+1] / secants[i]
+
+		if scale := alpha*alpha + beta*beta; scale > 9 {
+			tau := 3 / math.Sqrt(scale)
+			tangents[i] = tau * alpha * secants[i]
+			tangents[i+1] = tau * beta * secants[i]
+		}
+	}
+
+	return tangents
+}
+
+// segment finds the index of the point that starts the segment containing value
+func (ct *calibrationTable) segment(value float32, key func(CalibrationPoint) float32) int {
+	index := sort.Search(len(ct.points), func(i int) bool {
+		return key(ct.points[i]) > value
+	}) - 1
+
+	if index < 0 {
+		return 0
+	} else if index > len(ct.points)-2 {
+		return len(ct.points) - 2
+	}
+
+	return index
+}
+
+func (ct *calibrationTable) angleToPWM(angle float32) float32 {
+	i := ct.segment(angle, func(point CalibrationPoint) float32 {
+		return point.Angle
+	})
+
+	start, end := ct.points[i], ct.points[i+1]
+	width := float64(end.Angle - start.Angle)
+	t := float64(angle-start.Angle) / width
+
+	if ct.interpolation == InterpolationLinear {
+		return start.PWM + float32(t)*(end.PWM-start.PWM)
+	}
+
+	// outside of the table we just extend the end segments linearly
+	if angle <= start.Angle {
+		return start.PWM + (angle-start.Angle)*float32(ct.tangents[i])
+	} else if angle >= end.Angle {
+		return end.PWM + (angle-end.Angle)*float32(ct.tangents[i+1])
+	}
+
+	// cubic hermite basis
+	t2, t3 := t*t, t*t*t
+	h00 := 2*t3 - 3*t2 + 1
+	h10 := t3 - 2*t2 + t
+	h01 := -2*t3 + 3*t2
+	h11 := t3 - t2
+
+	return float32(h00*float64(start.PWM) + h10*width*ct.tangents[i] + h01*float64(end.PWM) + h11*width*ct.tangents[i+1])
+}
+
+func (ct *calibrationTable) pwmToAngle(pwm float32) float32 {
+	i := ct.segment(pwm, func(point CalibrationPoint) float32 {
+		return point.PWM
+	})
+
+	start, end := ct.points[i], ct.points[i+1]
+
+	if ct.interpolation == InterpolationLinear {
+		return start.Angle + (pwm-start.PWM)/(end.PWM-start.PWM)*(end.Angle-start.Angle)
+	}
+
+	// outside of the table we just extend the end segments linearly
+	if pwm <= start.PWM {
+		return start.Angle + (pwm-start.PWM)/float32(ct.tangents[i])
+	} else if pwm >= end.PWM {
+		return end.Angle + (pwm-end.PWM)/float32(ct.tangents[i+1])
+	}
+
+	// the spline is monotonic within the segment, so a bisection will always find the angle
+	low, high := start.Angle, end.Angle
+	for iteration := 0; iteration < 32; iteration++ {
+		mid := (low + high) / 2
+		if ct.angleToPWM(mid) < pwm {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	return (low + high) / 2
+}
@@ -0,0 +1,322 @@
+package servos
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// FeedbackMapping converts readings from a servo's feedback wire (ie - ADC counts)
+// into an angle, using two measured points; angles are as seen by the servo itself
+type FeedbackMapping struct {
+	MinCounts int16   `json:"minCounts"`
+	MinAngle  float32 `json:"minAngle"`
+	MaxCounts int16   `json:"maxCounts"`
+	MaxAngle  float32 `json:"maxAngle"`
+}
+
+// WithFeedback returns a copy of the servo type that can convert feedback readings
+func (st ServoType) WithFeedback(mapping FeedbackMapping) (ServoType, error) {
+	if mapping.MinCounts == mapping.MaxCounts {
+		return ServoType{}, fmt.Errorf("feedback counts must differ")
+	}
+
+	if mapping.MinAngle == mapping.MaxAngle {
+		return ServoType{}, fmt.Errorf("feedback angles must differ")
+	}
+
+	st.feedback = &mapping
+	return st, nil
+}
+
+func (st *ServoType) HasFeedback() bool {
+	return st.feedback != nil
+}
+
+func (st *ServoType) GetFeedbackMapping() (FeedbackMapping, bool) {
+	if st.feedback == nil {
+		return FeedbackMapping{}, false
+	}
+
+	return *st.feedback, true
+}
+
+func (st *ServoType) ConvertFeedbackToAngle(counts int16) (float32, error) {
+	if st.feedback == nil {
+		return 0, fmt.Errorf("servo type has no feedback mapping")
+	}
+
+	mapping := st.feedback
+	progress := (float32(counts) - float32(mapping.MinCounts)) / (float32(mapping.MaxCounts) - float32(mapping.MinCounts))
+	angle := mapping.MinAngle + progress*(mapping.MaxAngle-mapping.MinAngle)
+
+	if st.inverted {
+		return -angle, nil
+	}
+
+	return angle, nil
+}
+
+// FeedbackSource is something that can read a servo's feedback wire (ie - an ADS1115)
+type FeedbackSource interface {
+	ReadChannel(channel int) (int16, error)
+}
+
+type FeedbackEventType int
+
+const (
+	// the servo is being told to move but the joint isn't following
+	FeedbackStall FeedbackEventType = iota
+
+	// the servo is holding still but the joint isn't where it was told to be (ie - a
+	// slipped horn or too much load)
+	FeedbackDeviation
+)
+
+func (fet FeedbackEventType) String() string {
+	switch fet {
+	case FeedbackStall:
+		return "stall"
+	case FeedbackDeviation:
+		return "deviation"
+	}
+
+	return fmt.Sprintf("FeedbackEventType(%d)", int(fet))
+}
+
+type FeedbackEvent struct {
+	Type      FeedbackEventType
+	Name      string
+	Servo     *Servo
+	Commanded float32
+	Measured  float32
+	Since     time.Time
+}
+
+type FeedbackReading struct {
+	Name      string    `json:"name"`
+	Commanded float32   `json:"commanded"`
+	Measured  float32   `json:"measured"`
+	Error     float32   `json:"error"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type FeedbackMonitorOptions struct {
+	// how often every servo is checked
+	Interval time.Duration
+
+	// how far (in degrees) the measured angle may be from the commanded angle
+	Tolerance float32
+
+	// how long the servo has to be out of tolerance before an event is raised
+	Grace time.Duration
+}
+
+var DefaultFeedbackMonitorOptions = FeedbackMonitorOptions{
+	Interval:  100 * time.Millisecond,
+	Tolerance: 8,
+	Grace:     500 * time.Millisecond,
+}
+
+type feedbackEntry struct {
+	name    string
+	servo   *Servo
+	source  FeedbackSource
+	channel int
+
+	reading    FeedbackReading
+	outOfRange time.Time
+	raised     bool
+}
+
+// FeedbackMonitor compares commanded and measured angles to spot stalls, slipped
+// horns and overloaded joints
+type FeedbackMonitor struct {
+	mutex           sync.Mutex
+	options         FeedbackMonitorOptions
+	entries         []*feedbackEntry
+	stopWorkChannel chan bool
+	doneChannel     chan bool
+
+	// called (from the monitor's goroutine) whenever a servo goes out of tolerance
+	OnEvent func(FeedbackEvent)
+}
+
+func NewFeedbackMonitor(options *FeedbackMonitorOptions) *FeedbackMonitor {
+	fm := &FeedbackMonitor{
+		options: DefaultFeedbackMonitorOptions,
+		entries: []*feedbackEntry{},
+	}
+
+	if options != nil {
+		fm.options = *options
+	}
+
+	if fm.options.Interval <= 0 {
+		fm.options.Interval = DefaultFeedbackMonitorOptions.Interval
+	}
+
+	return fm
+}
+
+// Add starts monitoring a servo whose feedback wire is on the given channel of source
+func (fm *FeedbackMonitor) Add(name string, servo *Servo, source FeedbackSource, channel int) error {
+	servoType := servo.GetServoType()
+	if !servoType.HasFeedback() {
+		return fmt.Errorf("servo %s has no feedback mapping", name)
+	}
+
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	fm.entries = append(fm.entries, &feedbackEntry{
+		name:    name,
+		servo:   servo,
+		source:  source,
+		channel: channel,
+	})
+
+	return nil
+}
+
+func (fm *FeedbackMonitor) GetReadings() []FeedbackReading {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	readings := []FeedbackReading{}
+	for _, entry := range fm.entries {
+		readings = append(readings, entry.reading)
+	}
+
+	return readings
+}
+
+// Check reads every servo once, returning any new events; a servo that can't be
+// read doesn't stop the others being checked, and every failure is returned together
+func (fm *FeedbackMonitor) Check(now time.Time) ([]FeedbackEvent, error) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	events := []FeedbackEvent{}
+	errs := []error{}
+	for _, entry := range fm.entries {
+		counts, err := entry.source.ReadChannel(entry.channel)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not read feedback for %s: %w", entry.name, err))
+			continue
+		}
+
+		servoType := entry.servo.GetServoType()
+		measured, err := servoType.ConvertFeedbackToAngle(counts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not convert feedback for %s: %w", entry.name, err))
+			continue
+		}
+
+		commanded := entry.servo.GetAngle()
+		entry.reading = FeedbackReading{
+			Name:      entry.name,
+			Commanded: commanded,
+			Measured:  measured,
+			Error:     measured - commanded,
+			Timestamp: now,
+		}
+
+		if event, ok := fm.checkEntry(entry, now); ok {
+			events = append(events, event)
+		}
+	}
+
+	return events, errors.Join(errs...)
+}
+
+func (fm *FeedbackMonitor) checkEntry(entry *feedbackEntry, now time.Time) (FeedbackEvent, bool) {
+	// back in tolerance, so reset the episode
+	if math.Abs(float64(entry.reading.Error)) <= float64(fm.options.Tolerance) || !entry.servo.IsAttached() {
+		entry.outOfRange = time.Time{}
+		entry.raised = false
+		return FeedbackEvent{}, false
+	}
+
+	if entry.outOfRange.IsZero() {
+		entry.outOfRange = now
+	}
+
+	// only raise an event once per episode, and only once the grace period is over
+	if entry.raised || (now.Sub(entry.outOfRange) < fm.options.Grace) {
+		return FeedbackEvent{}, false
+	}
+
+	entry.raised = true
+
+	eventType := FeedbackDeviation
+	if entry.servo.IsMoving() {
+		eventType = FeedbackStall
+	}
+
+	return FeedbackEvent{
+		Type:      eventType,
+		Name:      entry.name,
+		Servo:     entry.servo,
+		Commanded: entry.reading.Commanded,
+		Measured:  entry.reading.Measured,
+		Since:     entry.outOfRange,
+	}, true
+}
+
+// Start checks every servo from a goroutine until Stop is called; calling it on a
+// monitor that is already running does nothing
+func (fm *FeedbackMonitor) Start() {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if fm.stopWorkChannel != nil {
+		return
+	}
+
+	fm.stopWorkChannel = make(chan bool)
+	fm.doneChannel = make(chan bool)
+
+	go fm.work(fm.stopWorkChannel, fm.doneChannel)
+}
+
+// Stop halts the monitor's loop, waiting for it to finish; calling it on a monitor
+// that isn't running does nothing
+func (fm *FeedbackMonitor) Stop() {
+	fm.mutex.Lock()
+	stopWorkChannel, doneChannel := fm.stopWorkChannel, fm.doneChannel
+	fm.stopWorkChannel, fm.doneChannel = nil, nil
+	fm.mutex.Unlock()
+
+	if stopWorkChannel == nil {
+		return
+	}
+
+	close(stopWorkChannel)
+	<-doneChannel
+}
+
+func (fm *FeedbackMonitor) work(stopWorkChannel, doneChannel chan bool) {
+	defer close(doneChannel)
+
+	ticker := time.NewTicker(fm.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopWorkChannel:
+			return
+		case now := <-ticker.C:
+			// a failed read just gets tried again on the next tick
+			events, _ := fm.Check(now)
+
+			if fm.OnEvent != nil {
+				for _, event := range events {
+					fm.OnEvent(event)
+				}
+			}
+		}
+	}
+}
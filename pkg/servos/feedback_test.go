@@ -0,0 +1,67 @@
+package servos
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeFeedbackSource returns fixed readings, failing for any channel without one
+type fakeFeedbackSource struct {
+	counts map[int]int16
+}
+
+func (ffs *fakeFeedbackSource) ReadChannel(channel int) (int16, error) {
+	counts, ok := ffs.counts[channel]
+	if !ok {
+		return 0, errors.New("no reading")
+	}
+
+	return counts, nil
+}
+
+func TestFeedbackCheckCarriesOnPastReadErrors(t *testing.T) {
+	servoType, err := ServoType_DS3225_90.WithFeedback(FeedbackMapping{
+		MinCounts: 0,
+		MinAngle:  -90,
+		MaxCounts: 1800,
+		MaxAngle:  90,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	controller := newFakeController()
+	source := &fakeFeedbackSource{
+		counts: map[int]int16{1: 900},
+	}
+
+	monitor := NewFeedbackMonitor(nil)
+	for channel, name := range []string{"broken", "working", "alsoBroken"} {
+		servo, err := New(channel, controller, servoType, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := monitor.Add(name, servo, source, channel); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = monitor.Check(time.Now())
+	if err == nil {
+		t.Fatal("expected read errors")
+	}
+
+	// both failures are reported
+	if joined, ok := err.(interface{ Unwrap() []error }); !ok || (len(joined.Unwrap()) != 2) {
+		t.Errorf("err = %v, want 2 errors", err)
+	}
+
+	// and the servo after the first failure was still read
+	readings := monitor.GetReadings()
+	if readings[1].Name != "working" {
+		t.Errorf("servo after a failed read wasn't checked: %+v", readings[1])
+	}
+}
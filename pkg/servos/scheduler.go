@@ -0,0 +1,324 @@
+package servos
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const DefaultSchedulerTickRate = time.Duration(ServoMovementSpeedMS) * time.Millisecond
+
+// Scheduler drives every registered servo from a single loop so that all of the
+// servos are stepped against the same timestamp and flushed to their boards together
+type Scheduler struct {
+	mutex           sync.Mutex
+	tickRate        time.Duration
+	servos          []*Servo
+	tasks           []Task
+	stopWorkChannel chan bool
+	doneChannel     chan bool
+	stats           SchedulerStats
+	lastTick        time.Time
+}
+
+// SchedulerStats describes how far the real ticks drifted from the requested tick rate
+type SchedulerStats struct {
+	TickRate      time.Duration `json:"tickRate"`
+	Ticks         uint64        `json:"ticks"`
+	LastJitter    time.Duration `json:"lastJitter"`
+	MeanJitter    time.Duration `json:"meanJitter"`
+	MaxJitter     time.Duration `json:"maxJitter"`
+	TotalJitter   time.Duration `json:"totalJitter"`
+	LastFlushTime time.Duration `json:"lastFlushTime"`
+	FlushErrors   uint64        `json:"flushErrors"`
+	LastFlushErr  string        `json:"lastFlushError,omitempty"`
+}
+
+// Task is run at the start of every tick, before the servos are stepped, so it can
+// retarget servos against the same clock (ie - to follow a path); Tick returns false
+// once the task is finished and should be dropped
+type Task interface {
+	Tick(now time.Time) bool
+}
+
+type scheduledUpdate struct {
+	servo *Servo
+	pwm   int
+}
+
+func NewScheduler(tickRate time.Duration) *Scheduler {
+	if tickRate <= 0 {
+		tickRate = DefaultSchedulerTickRate
+	}
+
+	return &Scheduler{
+		tickRate: tickRate,
+		servos:   []*Servo{},
+		tasks:    []Task{},
+		stats: SchedulerStats{
+			TickRate: tickRate,
+		},
+	}
+}
+
+func (sc *Scheduler) Register(servos ...*Servo) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	sc.servos = append(sc.servos, servos...)
+}
+
+func (sc *Scheduler) Unregister(servo *Servo) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	for i, registered := range sc.servos {
+		if registered == servo {
+			sc.servos = append(sc.servos[:i], sc.servos[i+1:]...)
+			return
+		}
+	}
+}
+
+func (sc *Scheduler) AddTask(task Task) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	sc.tasks = append(sc.tasks, task)
+}
+
+func (sc *Scheduler) RemoveTask(task Task) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	for i, added := range sc.tasks {
+		if added == task {
+			sc.tasks = append(sc.tasks[:i], sc.tasks[i+1:]...)
+			return
+		}
+	}
+}
+
+func (sc *Scheduler) GetTickRate() time.Duration {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	return sc.tickRate
+}
+
+// SetTickRate changes the tick rate, taking effect after the next tick if the scheduler is running
+func (sc *Scheduler) SetTickRate(tickRate time.Duration) {
+	if tickRate <= 0 {
+		tickRate = DefaultSchedulerTickRate
+	}
+
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	sc.tickRate = tickRate
+	sc.stats.TickRate = tickRate
+}
+
+func (sc *Scheduler) GetStats() SchedulerStats {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	return sc.stats
+}
+
+// Stop halts the scheduler's loop, waiting for the current tick to finish; calling
+// it on a scheduler that isn't running does nothing
+func (sc *Scheduler) Stop() {
+	sc.mutex.Lock()
+	stopWorkChannel, doneChannel := sc.stopWorkChannel, sc.doneChannel
+	sc.stopWorkChannel, sc.doneChannel = nil, nil
+	sc.mutex.Unlock()
+
+	if stopWorkChannel == nil {
+		return
+	}
+
+	close(stopWorkChannel)
+	<-doneChannel
+}
+
+// Done returns a channel that's closed once the scheduler's loop has stopped (it's
+// already closed if the scheduler isn't running)
+func (sc *Scheduler) Done() <-chan bool {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	if sc.doneChannel == nil {
+		stopped := make(chan bool)
+		close(stopped)
+
+		return stopped
+	}
+
+	return sc.doneChannel
+}
+
+// Start ticks the registered servos from a goroutine until Stop is called; calling
+// it on a scheduler that is already running does nothing
+func (sc *Scheduler) Start() {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	if sc.stopWorkChannel != nil {
+		return
+	}
+
+	sc.stopWorkChannel = make(chan bool)
+	sc.doneChannel = make(chan bool)
+	sc.lastTick = time.Time{}
+
+	go sc.work(sc.tickRate, sc.stopWorkChannel, sc.doneChannel)
+}
+
+// Step runs a single tick at now, exactly as the loop would; it's for driving a
+// scheduler that isn't running from a clock of your own (ie - stepping a simulated
+// robot through time in a test)
+func (sc *Scheduler) Step(now time.Time) {
+	sc.tick(now)
+}
+
+func (sc *Scheduler) work(tickRate time.Duration, stopWorkChannel, doneChannel chan bool) {
+	defer close(doneChannel)
+
+	ticker := time.NewTicker(tickRate)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopWorkChannel:
+			return
+		case now := <-ticker.C:
+			sc.tick(now)
+
+			// swap the ticker out if the tick rate was changed in the meantime
+			if newTickRate := sc.GetTickRate(); newTickRate != tickRate {
+				tickRate = newTickRate
+				ticker.Reset(tickRate)
+			}
+		}
+	}
+}
+
+func (sc *Scheduler) tick(now time.Time) {
+	sc.runTasks(now)
+
+	sc.mutex.Lock()
+	sc.recordJitter(now)
+	servos := append([]*Servo{}, sc.servos...)
+	sc.mutex.Unlock()
+
+	// work out every servo's next position for the same moment in time, grouping
+	// the results by the board they live on
+	updates := map[Controller][]scheduledUpdate{}
+	for _, servo := range servos {
+		if pwm, changed := servo.calculateStep(now); changed {
+			updates[servo.controller] = append(updates[servo.controller], scheduledUpdate{servo, pwm})
+		}
+	}
+
+	// now flush each board in one go, without holding the mutex across the writes
+	var flushErr error
+	for controller, boardUpdates := range updates {
+		if err := flushUpdates(controller, boardUpdates); (err != nil) && (flushErr == nil) {
+			flushErr = err
+		}
+	}
+
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	sc.stats.LastFlushTime = time.Since(now)
+	if flushErr != nil {
+		sc.stats.FlushErrors++
+		sc.stats.LastFlushErr = flushErr.Error()
+	}
+}
+
+// runTasks runs every task without holding the scheduler's mutex, so tasks are free
+// to add or remove tasks themselves
+func (sc *Scheduler) runTasks(now time.Time) {
+	sc.mutex.Lock()
+	tasks := append([]Task{}, sc.tasks...)
+	sc.mutex.Unlock()
+
+	for _, task := range tasks {
+		if !task.Tick(now) {
+			sc.RemoveTask(task)
+		}
+	}
+}
+
+func (sc *Scheduler) recordJitter(now time.Time) {
+	if !sc.lastTick.IsZero() {
+		jitter := now.Sub(sc.lastTick) - sc.tickRate
+		if jitter < 0 {
+			jitter = -jitter
+		}
+
+		sc.stats.Ticks++
+		sc.stats.LastJitter = jitter
+		sc.stats.TotalJitter += jitter
+		sc.stats.MeanJitter = sc.stats.TotalJitter / time.Duration(sc.stats.Ticks)
+
+		if jitter > sc.stats.MaxJitter {
+			sc.stats.MaxJitter = jitter
+		}
+	}
+
+	sc.lastTick = now
+}
+
+// flushUpdates writes runs of consecutive channels as a single transaction so a
+// leg's servos all change at the same time; a failed write doesn't stop the rest of
+// the runs being written, and the first error is returned
+func flushUpdates(controller Controller, updates []scheduledUpdate) error {
+	sort.Slice(updates, func(i, j int) bool {
+		return updates[i].servo.channel < updates[j].servo.channel
+	})
+
+	// hold every servo's lock across the writes so a Detach can't slip in between a
+	// step being worked out and it being written; its off pulse always lands last
+	for _, update := range updates {
+		update.servo.mutex.Lock()
+	}
+
+	defer func() {
+		for _, update := range updates {
+			update.servo.mutex.Unlock()
+		}
+	}()
+
+	attached := []scheduledUpdate{}
+	for _, update := range updates {
+		if !update.servo.detached {
+			attached = append(attached, update)
+		}
+	}
+
+	var flushErr error
+	start := 0
+	for i := 1; i <= len(attached); i++ {
+		if (i < len(attached)) && (attached[i].servo.channel == attached[i-1].servo.channel+1) {
+			continue
+		}
+
+		offs := []int{}
+		for _, update := range attached[start:i] {
+			offs = append(offs, update.pwm)
+		}
+
+		if err := controller.SetPWMs(attached[start].servo.channel, 0, offs); (err != nil) && (flushErr == nil) {
+			flushErr = fmt.Errorf("channels %d-%d: %w", attached[start].servo.channel, attached[i-1].servo.channel, err)
+		}
+
+		start = i
+	}
+
+	return flushErr
+}
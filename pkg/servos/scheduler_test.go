@@ -0,0 +1,376 @@
+package servos
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeController records the last pulse written to each channel instead of
+// talking to a board
+type fakeController struct {
+	mutex  sync.Mutex
+	offs   map[int]int
+	writes int
+	err    error
+}
+
+func newFakeController() *fakeController {
+	return &fakeController{
+		offs: map[int]int{},
+	}
+}
+
+func (fc *fakeController) SetPWM(channel, on, off int) error {
+	return fc.SetPWMs(channel, on, []int{off})
+}
+
+func (fc *fakeController) SetPWMs(channel, on int, offs []int) error {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	if fc.err != nil {
+		return fc.err
+	}
+
+	for i, off := range offs {
+		fc.offs[channel+i] = off
+	}
+
+	fc.writes++
+
+	return nil
+}
+
+func (fc *fakeController) getPWM(channel int) (int, bool) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	off, ok := fc.offs[channel]
+	return off, ok
+}
+
+func (fc *fakeController) setError(err error) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	fc.err = err
+}
+
+// countingTask counts its ticks and finishes after limit of them
+type countingTask struct {
+	mutex sync.Mutex
+	ticks int
+	limit int
+}
+
+func (ct *countingTask) Tick(now time.Time) bool {
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+
+	ct.ticks++
+	return ct.ticks < ct.limit
+}
+
+func newTestServo(t *testing.T, channel int, controller Controller) *Servo {
+	t.Helper()
+
+	servo, err := New(channel, controller, ServoType_DS3225_90, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return servo
+}
+
+func TestSchedulerStartStopIdempotent(t *testing.T) {
+	scheduler := NewScheduler(time.Millisecond)
+
+	// stopping a scheduler that was never started mustn't block
+	scheduler.Stop()
+
+	scheduler.Start()
+	scheduler.Start()
+	scheduler.Stop()
+	scheduler.Stop()
+}
+
+func TestSchedulerDone(t *testing.T) {
+	scheduler := NewScheduler(time.Millisecond)
+
+	// a scheduler that isn't running is already done
+	select {
+	case <-scheduler.Done():
+	default:
+		t.Fatal("done isn't closed before the scheduler starts")
+	}
+
+	scheduler.Start()
+	done := scheduler.Done()
+
+	select {
+	case <-done:
+		t.Fatal("done is closed while the scheduler is running")
+	default:
+	}
+
+	scheduler.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("done wasn't closed when the scheduler stopped")
+	}
+}
+
+func TestServoStartStopIdempotent(t *testing.T) {
+	servo := newTestServo(t, 0, newFakeController())
+
+	servo.Stop()
+	servo.Start()
+	servo.Start()
+	servo.Stop()
+	servo.Stop()
+}
+
+func TestSchedulerMovesServos(t *testing.T) {
+	controller := newFakeController()
+	servo := newTestServo(t, 0, controller)
+
+	scheduler := NewScheduler(time.Millisecond)
+	scheduler.Register(servo)
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	servo.MoveToAngle(45, 20*time.Millisecond)
+
+	deadline := time.Now().Add(time.Second)
+	for servo.IsMoving() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	want := int(ServoType_DS3225_90.ConvertAngleToPWM(45))
+	if got, _ := controller.getPWM(0); got != want {
+		t.Errorf("channel 0 = %d, want %d", got, want)
+	}
+}
+
+func TestSchedulerRecordsFlushErrors(t *testing.T) {
+	controller := newFakeController()
+	servo := newTestServo(t, 0, controller)
+	controller.setError(errors.New("bus error"))
+
+	scheduler := NewScheduler(time.Millisecond)
+	scheduler.Register(servo)
+
+	servo.MoveToAngle(45, 0)
+	scheduler.tick(time.Now().Add(time.Second))
+
+	stats := scheduler.GetStats()
+	if stats.FlushErrors != 1 {
+		t.Errorf("flush errors = %d, want 1", stats.FlushErrors)
+	}
+
+	if stats.LastFlushErr == "" {
+		t.Error("last flush error wasn't recorded")
+	}
+}
+
+func TestFlushUpdatesGroupsConsecutiveChannels(t *testing.T) {
+	controller := newFakeController()
+
+	updates := []scheduledUpdate{
+		{servo: newTestServo(t, 4, controller), pwm: 400},
+		{servo: newTestServo(t, 0, controller), pwm: 300},
+		{servo: newTestServo(t, 1, controller), pwm: 310},
+		{servo: newTestServo(t, 2, controller), pwm: 320},
+	}
+
+	controller.writes = 0
+	if err := flushUpdates(controller, updates); err != nil {
+		t.Fatal(err)
+	}
+
+	// channels 0-2 in one write and channel 4 in another
+	if controller.writes != 2 {
+		t.Errorf("writes = %d, want 2", controller.writes)
+	}
+
+	for _, update := range updates {
+		if got, _ := controller.getPWM(update.servo.channel); got != update.pwm {
+			t.Errorf("channel %d = %d, want %d", update.servo.channel, got, update.pwm)
+		}
+	}
+}
+
+func TestFlushUpdatesSkipsDetachedServos(t *testing.T) {
+	controller := newFakeController()
+	attached := newTestServo(t, 0, controller)
+	detached := newTestServo(t, 1, controller)
+
+	if err := detached.Detach(); err != nil {
+		t.Fatal(err)
+	}
+
+	updates := []scheduledUpdate{
+		{servo: attached, pwm: 300},
+		{servo: detached, pwm: 310},
+	}
+
+	if err := flushUpdates(controller, updates); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := controller.getPWM(0); got != 300 {
+		t.Errorf("channel 0 = %d, want 300", got)
+	}
+
+	if got, _ := controller.getPWM(1); got != 0 {
+		t.Errorf("detached channel 1 = %d, want 0", got)
+	}
+}
+
+func TestAttachPulsesOnNextStep(t *testing.T) {
+	controller := newFakeController()
+	servo := NewDetached(0, controller, ServoType_DS3225_90, 0)
+
+	scheduler := NewScheduler(time.Millisecond)
+	scheduler.Register(servo)
+
+	if err := servo.Attach(10, 10, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing goes out until the scheduler steps the servo
+	if _, ok := controller.getPWM(0); ok {
+		t.Fatal("attach wrote to the controller directly")
+	}
+
+	scheduler.tick(time.Now())
+
+	want := int(ServoType_DS3225_90.ConvertAngleToPWM(10))
+	if got, ok := controller.getPWM(0); !ok || (got != want) {
+		t.Errorf("channel 0 = %d (written %v), want %d", got, ok, want)
+	}
+}
+
+// TestDetachWhileMoving detaches servos part way through moves while the scheduler
+// is stepping them; the off pulse has to be the last thing each channel receives
+func TestDetachWhileMoving(t *testing.T) {
+	controller := newFakeController()
+	scheduler := NewScheduler(time.Millisecond)
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	for attempt := 0; attempt < 20; attempt++ {
+		servo := newTestServo(t, attempt, controller)
+		scheduler.Register(servo)
+
+		servo.MoveToAngle(80, 50*time.Millisecond)
+		time.Sleep(time.Duration(attempt%5) * time.Millisecond)
+
+		if err := servo.Detach(); err != nil {
+			t.Fatal(err)
+		}
+
+		// give the scheduler a few more ticks to (wrongly) write anything else
+		time.Sleep(5 * time.Millisecond)
+		scheduler.Unregister(servo)
+
+		if got, _ := controller.getPWM(attempt); got != 0 {
+			t.Errorf("channel %d = %d after detaching, want 0", attempt, got)
+		}
+	}
+}
+
+// TestSchedulerConcurrentUse is meant to be run with -race; it hammers the scheduler
+// and its servos from several goroutines while the scheduler is ticking
+func TestSchedulerConcurrentUse(t *testing.T) {
+	controller := newFakeController()
+	scheduler := NewScheduler(time.Millisecond)
+
+	servos := []*Servo{}
+	for channel := 0; channel < 6; channel++ {
+		servos = append(servos, newTestServo(t, channel, controller))
+	}
+
+	scheduler.Register(servos...)
+	scheduler.Start()
+
+	stop := make(chan bool)
+	wg := sync.WaitGroup{}
+	run := func(work func(i int)) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+					work(i)
+					time.Sleep(100 * time.Microsecond)
+				}
+			}
+		}()
+	}
+
+	// starting and stopping the loop
+	run(func(i int) {
+		if i%2 == 0 {
+			scheduler.Stop()
+		} else {
+			scheduler.Start()
+		}
+	})
+
+	// registering and unregistering servos
+	extra := newTestServo(t, 8, controller)
+	run(func(i int) {
+		if i%2 == 0 {
+			scheduler.Register(extra)
+		} else {
+			scheduler.Unregister(extra)
+		}
+	})
+
+	// adding and removing tasks
+	run(func(i int) {
+		task := &countingTask{limit: 3}
+		scheduler.AddTask(task)
+
+		if i%2 == 0 {
+			scheduler.RemoveTask(task)
+		}
+	})
+
+	// moving, detaching and reading the servos
+	run(func(i int) {
+		servo := servos[i%len(servos)]
+		servo.MoveToAngle(float32(i%90), 5*time.Millisecond)
+
+		if i%7 == 0 {
+			servo.Detach()
+			servo.Attach(0, 10, 5*time.Millisecond)
+		}
+	})
+
+	run(func(i int) {
+		for _, servo := range servos {
+			servo.GetSnapshot()
+			servo.GetTemperature()
+		}
+
+		scheduler.GetStats()
+		scheduler.SetTickRate(time.Duration(1+i%2) * time.Millisecond)
+	})
+
+	time.Sleep(200 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	scheduler.Stop()
+}
@@ -9,22 +9,37 @@ type ServoType struct {
 	// supplied
 	minHardwarePWM   int
 	maxHardwarePWM   int
+	centerPWMOffset  int
 	maxHardwareAngle float32
 	minLimitAngle    float32
 	maxLimitAngle    float32
 
+	// flips the sign of every angle going in or out, for servos mounted the other way around
+	inverted bool
+
 	// needs to be calculated
 	midHardwarePWM float32
 	minLimitPWM    float32
 	centerLimitPWM float32
 	maxLimitPWM    float32
+
+	// optional, measured points used in place of the linear model
+	calibration *calibrationTable
+
+	// optional, converts feedback wire readings into angles
+	feedback *FeedbackMapping
 }
 
-func NewServoType(minPWM, maxPWM, centerPWMOffset int, maxHardwareAngle, minLimitAngle, maxLimitAngle float32) ServoType {
+func NewServoType(minPWM, maxPWM, centerPWMOffset int, maxHardwareAngle, minLimitAngle, maxLimitAngle float32) (ServoType, error) {
+	if err := validateServoType(minPWM, maxPWM, centerPWMOffset, maxHardwareAngle, minLimitAngle, maxLimitAngle); err != nil {
+		return ServoType{}, err
+	}
+
 	// cache all of the user values first
 	st := ServoType{
 		minHardwarePWM:   minPWM,
 		maxHardwarePWM:   maxPWM,
+		centerPWMOffset:  centerPWMOffset,
 		maxHardwareAngle: maxHardwareAngle,
 		minLimitAngle:    minLimitAngle,
 		maxLimitAngle:    maxLimitAngle,
@@ -33,65 +48,92 @@ func NewServoType(minPWM, maxPWM, centerPWMOffset int, maxHardwareAngle, minLimi
 	// calculate all of the extra data points
 	st.midHardwarePWM = float32(minPWM) + (float32(maxPWM-minPWM) / 2)
 	st.centerLimitPWM = st.midHardwarePWM + float32(centerPWMOffset)
-	st.minLimitPWM = st.calculateMinLimitPWM(centerPWMOffset)
-	st.maxLimitPWM = st.calculateMaxLimitPWM(centerPWMOffset)
+	minLimitPWM, minClamped := st.calculateLimitPWM(minLimitAngle)
+	maxLimitPWM, maxClamped := st.calculateLimitPWM(maxLimitAngle)
+	st.minLimitPWM = minLimitPWM
+	st.maxLimitPWM = maxLimitPWM
+
+	// the limits may have been pulled in to fit the hardware, so make sure there's
+	// still some range of motion left
+	if st.minLimitPWM >= st.maxLimitPWM {
+		return ServoType{}, fmt.Errorf("limit angles %f to %f fall outside of the hardware range", minLimitAngle, maxLimitAngle)
+	}
+
+	// if a limit had to be pulled in to fit the hardware, adjust its angle to match
+	if minClamped {
+		st.minLimitAngle = (st.minLimitPWM - st.centerLimitPWM) / st.getPWMPerDegree()
+	}
 
-	// if there was a center pwm offset, adjust min/max limit angle values
-	if centerPWMOffset != 0 {
-		st.minLimitAngle = ((st.centerLimitPWM - st.minLimitPWM) / (0 - st.getPWMPerDegree()))
+	if maxClamped {
 		st.maxLimitAngle = (st.maxLimitPWM - st.centerLimitPWM) / st.getPWMPerDegree()
 	}
 
 	// finally, return the object
+	return st, nil
+}
+
+// MustNewServoType is like NewServoType but panics if the values are invalid; it's
+// meant for package level declarations
+func MustNewServoType(minPWM, maxPWM, centerPWMOffset int, maxHardwareAngle, minLimitAngle, maxLimitAngle float32) ServoType {
+	st, err := NewServoType(minPWM, maxPWM, centerPWMOffset, maxHardwareAngle, minLimitAngle, maxLimitAngle)
+	if err != nil {
+		panic(err)
+	}
+
 	return st
 }
 
-func (st *ServoType) calculateMinLimitPWM(centerPWMOffset int) float32 {
-	// make sure the min angle limit is not less than what the hardware can support (split down the middle)
-	if st.minLimitAngle < (0 - (st.maxHardwareAngle / 2)) {
-		return float32(st.minHardwarePWM)
+func validateServoType(minPWM, maxPWM, centerPWMOffset int, maxHardwareAngle, minLimitAngle, maxLimitAngle float32) error {
+	if minPWM < 0 {
+		return fmt.Errorf("invalid min hardware pwm: %d", minPWM)
 	}
 
-	// calculate the min limit pwm based on a negative min angle limit
-	// NOTE: this code will break if the min angle limit is a positive number ie - (min: 30 max: 40)
-	minLimitPWM := (st.midHardwarePWM - ((0 - st.getPWMPerDegree()) * st.minLimitAngle))
+	if maxPWM <= minPWM {
+		return fmt.Errorf("max hardware pwm (%d) must be greater than min hardware pwm (%d)", maxPWM, minPWM)
+	}
 
-	// if possible, adjust the minimum limit pwm by the center offset pwm (to maintain proportions)
-	minLimitPWM += float32(centerPWMOffset)
+	if !isFinite(maxHardwareAngle) || (maxHardwareAngle <= 0) {
+		return fmt.Errorf("invalid max hardware angle: %f", maxHardwareAngle)
+	}
 
-	// however, we still need to make sure the min limit pwm hasn't gone out of range of what the
-	// hardware can handle
-	// todo: maybe show some sort of warning this adjustment happened because of the offset
-	if minLimitPWM < float32(st.minHardwarePWM) {
-		minLimitPWM = float32(st.minHardwarePWM)
+	if !isFinite(minLimitAngle) || !isFinite(maxLimitAngle) {
+		return fmt.Errorf("invalid limit angles: %f to %f", minLimitAngle, maxLimitAngle)
 	}
 
-	// finally, return the min limit pwm
-	return minLimitPWM
-}
+	if minLimitAngle >= maxLimitAngle {
+		return fmt.Errorf("min limit angle (%f) must be less than max limit angle (%f)", minLimitAngle, maxLimitAngle)
+	}
 
-func (st *ServoType) calculateMaxLimitPWM(centerPWMOffset int) float32 {
-	// make sure the max angle limit is not more than what the hardware can support (split down the middle)
-	if st.maxLimitAngle > (st.maxHardwareAngle / 2) {
-		return float32(st.maxHardwarePWM)
+	// the center has to be somewhere the hardware can actually reach
+	midHardwarePWM := float32(minPWM) + (float32(maxPWM-minPWM) / 2)
+	if abs := math.Abs(float64(centerPWMOffset)); float32(abs) > (midHardwarePWM - float32(minPWM)) {
+		return fmt.Errorf("center pwm offset (%d) moves the center outside of the hardware range", centerPWMOffset)
 	}
 
-	// calculate the max limit pwm based on a positive angle limit
-	// NOTE: this code will break if the max angle limit is a negative number -ie (min: -50 max: -30)
-	maxLimitPWM := (st.midHardwarePWM + (st.getPWMPerDegree() * st.maxLimitAngle))
+	return nil
+}
 
-	// if possible, adjust the maximum limit pwm by the center offset pwm (to maintain proportions)
-	maxLimitPWM += float32(centerPWMOffset)
+func isFinite(value float32) bool {
+	return !math.IsNaN(float64(value)) && !math.IsInf(float64(value), 0)
+}
 
-	// however, we still need to make sure the max limit pwm hasn't gone out of range of what the
+// calculateLimitPWM returns the pwm for a limit angle and whether or not it had to
+// be clamped to fit the hardware
+func (st *ServoType) calculateLimitPWM(limitAngle float32) (float32, bool) {
+	// work out the limit pwm relative to the (possibly offset) center, which holds
+	// for any limit angle whether it's positive, negative or zero
+	limitPWM := st.centerLimitPWM + (limitAngle * st.getPWMPerDegree())
+
+	// however, we still need to make sure the limit pwm hasn't gone out of range of what the
 	// hardware can handle
-	// todo: maybe show some sort of warning this adjustment happened because of the offset
-	if maxLimitPWM > float32(st.maxHardwarePWM) {
-		maxLimitPWM = float32(st.maxHardwarePWM)
+	if limitPWM < float32(st.minHardwarePWM) {
+		return float32(st.minHardwarePWM), true
+	} else if limitPWM > float32(st.maxHardwarePWM) {
+		return float32(st.maxHardwarePWM), true
 	}
 
-	// finally, return the max limit pwm
-	return maxLimitPWM
+	// finally, return the limit pwm
+	return limitPWM, false
 }
 
 func (st *ServoType) getPWMPerDegree() float32 {
@@ -114,11 +156,33 @@ func (st *ServoType) GetMaxHardwareAngle() float32 {
 	return st.maxHardwareAngle
 }
 
+func (st *ServoType) GetCenterPWMOffset() int {
+	return st.centerPWMOffset
+}
+
+// WithInverted returns a copy of the servo type that flips the sign of every angle
+func (st ServoType) WithInverted(inverted bool) ServoType {
+	st.inverted = inverted
+	return st
+}
+
+func (st *ServoType) IsInverted() bool {
+	return st.inverted
+}
+
 func (st *ServoType) GetMinLimitAngle() float32 {
+	if st.inverted {
+		return -st.maxLimitAngle
+	}
+
 	return st.minLimitAngle
 }
 
 func (st *ServoType) GetMaxLimitAngle() float32 {
+	if st.inverted {
+		return -st.minLimitAngle
+	}
+
 	return st.maxLimitAngle
 }
 
@@ -135,6 +199,10 @@ func (st *ServoType) GetMaxLimitPWM() float32 {
 }
 
 func (st *ServoType) ConvertAngleToPWM(angle float32) float32 {
+	if st.inverted {
+		angle = -angle
+	}
+
 	// keep the angle within bounds
 	if angle < st.minLimitAngle {
 		return st.minLimitPWM
@@ -142,19 +210,24 @@ func (st *ServoType) ConvertAngleToPWM(angle float32) float32 {
 		return st.maxLimitPWM
 	}
 
+	if st.calibration != nil {
+		return st.calibration.angleToPWM(angle)
+	}
+
 	return st.centerLimitPWM + (angle * st.getPWMPerDegree())
 }
 
 func (st *ServoType) ConvertPWMToAngle(pwm int) float32 {
-	pwmF := float32(pwm)
+	angle := (float32(pwm) - st.centerLimitPWM) / st.getPWMPerDegree()
+	if st.calibration != nil {
+		angle = st.calibration.pwmToAngle(float32(pwm))
+	}
 
-	if pwmF < st.centerLimitPWM {
-		return (st.centerLimitPWM - pwmF) / (0 - st.getPWMPerDegree())
-	} else if pwmF > st.centerLimitPWM {
-		return (pwmF - st.centerLimitPWM) / st.getPWMPerDegree()
+	if st.inverted {
+		return -angle
 	}
 
-	return st.centerLimitPWM
+	return angle
 }
 
 func (st *ServoType) DebugOutput() {
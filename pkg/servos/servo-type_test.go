@@ -0,0 +1,157 @@
+package servos
+
+import (
+	"math"
+	"testing"
+)
+
+const conversionTolerance = 0.01
+
+func TestNewServoTypeValidation(t *testing.T) {
+	tests := []struct {
+		name                         string
+		minPWM, maxPWM, centerOffset int
+		maxHardwareAngle             float32
+		minLimitAngle, maxLimitAngle float32
+		wantErr                      bool
+	}{
+		{"symmetric", 135, 538, 0, 270, -90, 90, false},
+		{"asymmetric", 135, 538, -20, 270, -135, 120, false},
+		{"both positive", 135, 538, 0, 270, 10, 80, false},
+		{"both negative", 135, 538, 0, 270, -80, -10, false},
+		{"negative min pwm", -1, 538, 0, 270, -90, 90, true},
+		{"max pwm below min", 538, 135, 0, 270, -90, 90, true},
+		{"zero hardware angle", 135, 538, 0, 0, -90, 90, true},
+		{"nan limit", 135, 538, 0, 270, float32(math.NaN()), 90, true},
+		{"limits reversed", 135, 538, 0, 270, 90, -90, true},
+		{"limits equal", 135, 538, 0, 270, 45, 45, true},
+		{"center outside hardware", 135, 538, 300, 270, -90, 90, true},
+		{"limits outside hardware", 135, 538, 0, 270, 140, 150, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewServoType(test.minPWM, test.maxPWM, test.centerOffset, test.maxHardwareAngle, test.minLimitAngle, test.maxLimitAngle)
+			if (err != nil) != test.wantErr {
+				t.Errorf("err = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestConvertAngleToPWM(t *testing.T) {
+	symmetric := MustNewServoType(135, 538, 0, 270, -90, 90)
+	offset := MustNewServoType(135, 538, -20, 270, -135, 120)
+	positive := MustNewServoType(135, 538, 0, 270, 10, 80)
+	inverted := symmetric.WithInverted(true)
+
+	pwmPerDegree := float32(538-135) / 270
+
+	tests := []struct {
+		name      string
+		servoType ServoType
+		angle     float32
+		want      float32
+	}{
+		{"centre", symmetric, 0, 336.5},
+		{"min limit", symmetric, -90, 336.5 - (90 * pwmPerDegree)},
+		{"max limit", symmetric, 90, 336.5 + (90 * pwmPerDegree)},
+		{"below min limit clamps", symmetric, -120, 336.5 - (90 * pwmPerDegree)},
+		{"above max limit clamps", symmetric, 120, 336.5 + (90 * pwmPerDegree)},
+		{"offset centre", offset, 0, 316.5},
+		{"offset max limit", offset, 120, 316.5 + (120 * pwmPerDegree)},
+		{"offset min limit clamps to hardware", offset, -135, 135},
+		{"positive range clamps below", positive, 0, 336.5 + (10 * pwmPerDegree)},
+		{"positive range", positive, 45, 336.5 + (45 * pwmPerDegree)},
+		{"inverted centre", inverted, 0, 336.5},
+		{"inverted", inverted, 45, 336.5 - (45 * pwmPerDegree)},
+		{"inverted clamps", inverted, -120, 336.5 + (90 * pwmPerDegree)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.servoType.ConvertAngleToPWM(test.angle); math.Abs(float64(got-test.want)) > conversionTolerance {
+				t.Errorf("ConvertAngleToPWM(%f) = %f, want %f", test.angle, got, test.want)
+			}
+		})
+	}
+}
+
+func TestConvertPWMToAngle(t *testing.T) {
+	symmetric := MustNewServoType(135, 538, 0, 270, -90, 90)
+	offset := MustNewServoType(135, 538, -20, 270, -135, 120)
+	inverted := symmetric.WithInverted(true)
+
+	degreesPerPWM := 270 / float32(538-135)
+
+	tests := []struct {
+		name      string
+		servoType ServoType
+		pwm       int
+		want      float32
+	}{
+		{"centre", symmetric, 336, -0.5 * degreesPerPWM},
+		{"above centre", symmetric, 400, 63.5 * degreesPerPWM},
+		{"below centre", symmetric, 250, -86.5 * degreesPerPWM},
+		{"offset centre", offset, 316, -0.5 * degreesPerPWM},
+		{"inverted", inverted, 400, -63.5 * degreesPerPWM},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.servoType.ConvertPWMToAngle(test.pwm); math.Abs(float64(got-test.want)) > conversionTolerance {
+				t.Errorf("ConvertPWMToAngle(%d) = %f, want %f", test.pwm, got, test.want)
+			}
+		})
+	}
+}
+
+func TestConversionRoundTrip(t *testing.T) {
+	servoTypes := map[string]ServoType{
+		"symmetric": MustNewServoType(135, 538, 0, 270, -90, 90),
+		"offset":    MustNewServoType(135, 538, -20, 270, -135, 120),
+		"positive":  MustNewServoType(135, 538, 0, 270, 10, 80),
+		"negative":  MustNewServoType(135, 538, 0, 270, -80, -10),
+		"inverted":  MustNewServoType(135, 538, 12, 270, -90, 90).WithInverted(true),
+	}
+
+	for name, servoType := range servoTypes {
+		t.Run(name, func(t *testing.T) {
+			// the conversion back goes through a whole pwm, so allow for a step
+			tolerance := float64(servoType.GetMaxHardwareAngle()) / float64(servoType.GetMaxHardwarePWM()-servoType.GetMinHardwarePWM())
+
+			for angle := servoType.GetMinLimitAngle(); angle <= servoType.GetMaxLimitAngle(); angle++ {
+				pwm := servoType.ConvertAngleToPWM(angle)
+				got := servoType.ConvertPWMToAngle(int(math.Round(float64(pwm))))
+
+				if math.Abs(float64(got-angle)) > tolerance {
+					t.Errorf("angle %f -> pwm %f -> angle %f", angle, pwm, got)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitAngles(t *testing.T) {
+	offset := MustNewServoType(135, 538, -20, 270, -135, 120)
+
+	// the min limit doesn't fit the hardware, so it gets pulled in
+	wantMin := (135 - float32(316.5)) * 270 / float32(538-135)
+	if got := offset.GetMinLimitAngle(); math.Abs(float64(got-wantMin)) > conversionTolerance {
+		t.Errorf("min limit angle = %f, want %f", got, wantMin)
+	}
+
+	if got := offset.GetMaxLimitAngle(); got != 120 {
+		t.Errorf("max limit angle = %f, want 120", got)
+	}
+
+	// inverting swaps and negates the limits
+	inverted := offset.WithInverted(true)
+	if got := inverted.GetMinLimitAngle(); got != -120 {
+		t.Errorf("inverted min limit angle = %f, want -120", got)
+	}
+
+	if got := inverted.GetMaxLimitAngle(); math.Abs(float64(got+wantMin)) > conversionTolerance {
+		t.Errorf("inverted max limit angle = %f, want %f", got, -wantMin)
+	}
+}
@@ -1,28 +1,30 @@
 package servos
 
-var ServoType_DS3225_90 = NewServoType(135, 538, 0, 270.0, -90.0, 90.0)
-var ServoType_DS3225_135 = NewServoType(135, 538, 0, 270.0, -135, 135)
+var ServoType_DS3225_90 = MustNewServoType(135, 538, 0, 270.0, -90.0, 90.0)
+var ServoType_DS3225_135 = MustNewServoType(135, 538, 0, 270.0, -135, 135)
 
-var ServoType_RightLeg1_Coxa = NewServoType(135, 538, 0, 270.0, -90.0, 90.0)
-var ServoType_RightLeg1_Femur = NewServoType(135, 538, -20, 270.0, -135.0, 120.0)
-var ServoType_RightLeg1_Tibia = NewServoType(135, 538, 1, 270.0, -135.0, 135.0)
+var ServoType_RightLeg1_Coxa = MustNewServoType(135, 538, 0, 270.0, -90.0, 90.0)
+var ServoType_RightLeg1_Femur = MustNewServoType(135, 538, -20, 270.0, -135.0, 120.0)
+var ServoType_RightLeg1_Tibia = MustNewServoType(135, 538, 1, 270.0, -135.0, 135.0)
 
-var ServoType_RightLeg2_Coxa = NewServoType(135, 538, -11, 270.0, -90.0, 90.0)
-var ServoType_RightLeg2_Femur = NewServoType(135, 538, 5, 270.0, -135.0, 120.0)
-var ServoType_RightLeg2_Tibia = NewServoType(135, 538, -15, 270.0, -135.0, 135.0)
+var ServoType_RightLeg2_Coxa = MustNewServoType(135, 538, -11, 270.0, -90.0, 90.0)
+var ServoType_RightLeg2_Femur = MustNewServoType(135, 538, 5, 270.0, -135.0, 120.0)
+var ServoType_RightLeg2_Tibia = MustNewServoType(135, 538, -15, 270.0, -135.0, 135.0)
 
-var ServoType_RightLeg3_Coxa = NewServoType(135, 538, -5, 270.0, -90.0, 90.0)
-var ServoType_RightLeg3_Femur = NewServoType(135, 538, -10, 270.0, -135.0, 120.0)
-var ServoType_RightLeg3_Tibia = NewServoType(135, 538, -11, 270.0, -135.0, 135.0)
+var ServoType_RightLeg3_Coxa = MustNewServoType(135, 538, -5, 270.0, -90.0, 90.0)
+var ServoType_RightLeg3_Femur = MustNewServoType(135, 538, -10, 270.0, -135.0, 120.0)
+var ServoType_RightLeg3_Tibia = MustNewServoType(135, 538, -11, 270.0, -135.0, 135.0)
 
-var ServoType_LeftLeg1_Coxa = NewServoType(135, 538, 22, 270.0, -90.0, 90.0)
-var ServoType_LeftLeg1_Femur = NewServoType(135, 538, 12, 270.0, -135.0, 120.0)
-var ServoType_LeftLeg1_Tibia = NewServoType(135, 538, 24, 270.0, -135.0, 135.0)
+// the left legs are mounted as a mirror image of the right, so their servos turn the
+// other way for the same angle (see legs.Side)
+var ServoType_LeftLeg1_Coxa = MustNewServoType(135, 538, 22, 270.0, -90.0, 90.0).WithInverted(true)
+var ServoType_LeftLeg1_Femur = MustNewServoType(135, 538, 12, 270.0, -135.0, 120.0).WithInverted(true)
+var ServoType_LeftLeg1_Tibia = MustNewServoType(135, 538, 24, 270.0, -135.0, 135.0).WithInverted(true)
 
-var ServoType_LeftLeg2_Coxa = NewServoType(135, 538, 0, 270.0, -90.0, 90.0)
-var ServoType_LeftLeg2_Femur = NewServoType(135, 538, 11, 270.0, -135.0, 120.0)
-var ServoType_LeftLeg2_Tibia = NewServoType(135, 538, 20, 270.0, -135.0, 135.0)
+var ServoType_LeftLeg2_Coxa = MustNewServoType(135, 538, 0, 270.0, -90.0, 90.0).WithInverted(true)
+var ServoType_LeftLeg2_Femur = MustNewServoType(135, 538, 11, 270.0, -135.0, 120.0).WithInverted(true)
+var ServoType_LeftLeg2_Tibia = MustNewServoType(135, 538, 20, 270.0, -135.0, 135.0).WithInverted(true)
 
-var ServoType_LeftLeg3_Coxa = NewServoType(135, 538, -7, 270.0, -90.0, 90.0)
-var ServoType_LeftLeg3_Femur = NewServoType(135, 538, 4, 270.0, -135.0, 120.0)
-var ServoType_LeftLeg3_Tibia = NewServoType(135, 538, 12, 270.0, -135.0, 135.0)
+var ServoType_LeftLeg3_Coxa = MustNewServoType(135, 538, -7, 270.0, -90.0, 90.0).WithInverted(true)
+var ServoType_LeftLeg3_Femur = MustNewServoType(135, 538, 4, 270.0, -135.0, 120.0).WithInverted(true)
+var ServoType_LeftLeg3_Tibia = MustNewServoType(135, 538, 12, 270.0, -135.0, 135.0).WithInverted(true)
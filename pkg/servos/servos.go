@@ -1,46 +1,105 @@
 package servos
 
 import (
+	"fmt"
 	"math"
+	"sync"
 	"time"
 
 	"github.com/carldanley/hexapod/pkg/easings"
-	"github.com/carldanley/hexapod/pkg/pca9685"
 )
 
 const ServoMovementSpeedMS = 18
 
+const DefaultEasing = "LinearNone"
+
+// Controller is the board a servo sends its pulses to (ie - a PCA9685)
+type Controller interface {
+	SetPWM(channel, on, off int) error
+	SetPWMs(channel, on int, offs []int) error
+}
+
+// Servo is safe for concurrent use; moves may be requested from any goroutine
+// while the servo is being stepped by its own loop or by a Scheduler
 type Servo struct {
-	channel         int
-	controller      *pca9685.PCA9685
-	servoType       ServoType
+	channel    int
+	controller Controller
+	servoType  ServoType
+
+	mutex           sync.Mutex
 	stopWorkChannel chan bool
+	doneChannel     chan bool
 
 	currentPWM      float32
 	beginningPWM    float32
 	endingPWM       float32
 	easingStartTime time.Time
 	easingDuration  time.Duration
+	easingName      string
+	easing          easings.Func
+
+	// while detached no pulses are sent, so the servo goes limp
+	detached bool
+
+	// set by Attach so the next step sends a pulse even if the servo isn't moving
+	pendingPulse bool
+
+	// estimated motor temperature (see ThermalModel)
+	thermalModel      ThermalModel
+	holdingLoad       float32
+	temperature       float32
+	lastThermalUpdate time.Time
+}
+
+// Snapshot is a point in time view of a servo and the move it's working through
+type Snapshot struct {
+	Channel     int           `json:"channel"`
+	PWM         float32       `json:"pwm"`
+	Angle       float32       `json:"angle"`
+	StartPWM    float32       `json:"startPWM"`
+	TargetPWM   float32       `json:"targetPWM"`
+	TargetAngle float32       `json:"targetAngle"`
+	StartTime   time.Time     `json:"startTime"`
+	Duration    time.Duration `json:"duration"`
+	Easing      string        `json:"easing"`
+	Progress    float32       `json:"progress"`
+	Moving      bool          `json:"moving"`
+	Attached    bool          `json:"attached"`
+	Temperature float32       `json:"temperature"`
+}
+
+func New(channel int, controller Controller, servoType ServoType, defaultAngle float32) (*Servo, error) {
+	servo := NewDetached(channel, controller, servoType, defaultAngle)
+	servo.detached = false
+
+	// we have to set the servo's position right off the bat (in order
+	// to accurately do the math for easing)
+	if err := controller.SetPWM(channel, 0, int(servo.currentPWM)); err != nil {
+		return nil, err
+	}
+
+	return servo, nil
 }
 
-func New(channel int, controller *pca9685.PCA9685, servoType ServoType, defaultAngle float32) (*Servo, error) {
-	servo := &Servo{
+// NewDetached sets up a servo without sending it any pulses; nothing moves until
+// Attach is called (see the hexapod's startup sequence)
+func NewDetached(channel int, controller Controller, servoType ServoType, defaultAngle float32) *Servo {
+	return &Servo{
 		channel:         channel,
 		controller:      controller,
 		servoType:       servoType,
-		stopWorkChannel: make(chan bool),
 		beginningPWM:    servoType.ConvertAngleToPWM(defaultAngle),
 		endingPWM:       servoType.ConvertAngleToPWM(defaultAngle),
 		currentPWM:      servoType.ConvertAngleToPWM(defaultAngle),
 		easingStartTime: time.Now(),
 		easingDuration:  time.Duration(0),
+		easingName:      DefaultEasing,
+		easing:          easings.LinearNone,
+		detached:        true,
+		thermalModel:    DefaultThermalModel,
+		holdingLoad:     1,
+		temperature:     DefaultThermalModel.AmbientTemperature,
 	}
-
-	// we have to set the servo's position right off the bat (in order
-	// to accurately do the math for easing)
-	controller.SetPWM(channel, 0, int(servo.currentPWM))
-
-	return servo, nil
 }
 
 func (s *Servo) MoveToAngle(angle float32, duration time.Duration) {
@@ -48,35 +107,222 @@ func (s *Servo) MoveToAngle(angle float32, duration time.Duration) {
 }
 
 func (s *Servo) MoveToPWM(pwm float32, duration time.Duration) {
+	s.MoveToPWMAt(pwm, time.Now(), duration)
+}
+
+// MoveToAngleAt is MoveToAngle with the move timed from startTime rather than now
+// (ie - the scheduler's tick time, so a task's moves line up with its steps)
+func (s *Servo) MoveToAngleAt(angle float32, startTime time.Time, duration time.Duration) {
+	s.MoveToPWMAt(s.servoType.ConvertAngleToPWM(angle), startTime, duration)
+}
+
+func (s *Servo) MoveToPWMAt(pwm float32, startTime time.Time, duration time.Duration) {
 	if pwm < s.servoType.GetMinLimitPWM() {
 		pwm = s.servoType.GetMinLimitPWM()
 	} else if pwm > s.servoType.GetMaxLimitPWM() {
 		pwm = s.servoType.GetMaxLimitPWM()
 	}
 
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	// setup a few of the easing variables
 	s.beginningPWM = s.currentPWM
 	s.endingPWM = pwm
-	s.easingStartTime = time.Now()
+	s.easingStartTime = startTime
 	s.easingDuration = duration
 
 	// handle cases where the servo needs to move directly to the pwm
 	if s.easingDuration.Milliseconds() < ServoMovementSpeedMS {
-		s.easingDuration = ServoMovementSpeedMS
+		s.easingDuration = time.Duration(ServoMovementSpeedMS) * time.Millisecond
+	}
+}
+
+// BackOff eases the servo back towards where its last move started by (at most) the
+// given angle, which relieves a joint that has jammed against something
+func (s *Servo) BackOff(angle float32, duration time.Duration) {
+	s.mutex.Lock()
+	start := s.servoType.ConvertPWMToAngle(int(s.beginningPWM))
+	current := s.servoType.ConvertPWMToAngle(int(s.currentPWM))
+	s.mutex.Unlock()
+
+	travel := start - current
+	if travel > angle {
+		travel = angle
+	} else if travel < -angle {
+		travel = -angle
+	}
+
+	if travel != 0 {
+		s.MoveToAngle(current+travel, duration)
+	}
+}
+
+// SetEasing picks the easing function (by name, ie - "SineInOut") used by subsequent moves
+func (s *Servo) SetEasing(name string) error {
+	easing, ok := easings.Lookup(name)
+	if !ok {
+		return fmt.Errorf("unknown easing: %s", name)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.easingName = name
+	s.easing = easing
+
+	return nil
+}
+
+func (s *Servo) GetServoType() ServoType {
+	return s.servoType
+}
+
+func (s *Servo) GetChannel() int {
+	return s.channel
+}
+
+func (s *Servo) GetPWM() float32 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.currentPWM
+}
+
+func (s *Servo) GetAngle() float32 {
+	return s.servoType.ConvertPWMToAngle(int(s.GetPWM()))
+}
+
+func (s *Servo) GetTargetPWM() float32 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.endingPWM
+}
+
+func (s *Servo) GetTarget() float32 {
+	return s.servoType.ConvertPWMToAngle(int(s.GetTargetPWM()))
+}
+
+func (s *Servo) IsMoving() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.isMoving()
+}
+
+func (s *Servo) isMoving() bool {
+	return int(s.currentPWM) != int(s.endingPWM)
+}
+
+func (s *Servo) GetSnapshot() Snapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// work out how far through the current move we are
+	progress := float32(1)
+	if s.isMoving() && (s.easingDuration > 0) {
+		progress = float32(time.Since(s.easingStartTime)) / float32(s.easingDuration)
+		progress = float32(math.Max(0, math.Min(1, float64(progress))))
+	}
+
+	return Snapshot{
+		Channel:     s.channel,
+		PWM:         s.currentPWM,
+		Angle:       s.servoType.ConvertPWMToAngle(int(s.currentPWM)),
+		StartPWM:    s.beginningPWM,
+		TargetPWM:   s.endingPWM,
+		TargetAngle: s.servoType.ConvertPWMToAngle(int(s.endingPWM)),
+		StartTime:   s.easingStartTime,
+		Duration:    s.easingDuration,
+		Easing:      s.easingName,
+		Progress:    progress,
+		Moving:      s.isMoving(),
+		Attached:    !s.detached,
+		Temperature: s.temperature,
+	}
+}
+
+// Detach stops sending pulses to the servo so it goes limp (ie - for folding the
+// robot up or posing it by hand)
+func (s *Servo) Detach() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.detached = true
+
+	// a pulse that's never switched on
+	return s.controller.SetPWM(s.channel, 0, 0)
+}
+
+// Attach starts sending pulses again. The servo is assumed to be sitting at fromAngle
+// and ramps over to toAngle, so it doesn't snap to wherever it was last commanded.
+// Like any other move, nothing is sent until the servo's next step (from a Scheduler
+// or its own loop), which sends the first pulse even if fromAngle and toAngle match.
+func (s *Servo) Attach(fromAngle, toAngle float32, ramp time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.currentPWM = s.servoType.ConvertAngleToPWM(fromAngle)
+	s.beginningPWM = s.currentPWM
+	s.endingPWM = s.servoType.ConvertAngleToPWM(toAngle)
+	s.easingStartTime = time.Now()
+	s.easingDuration = ramp
+	s.detached = false
+	s.pendingPulse = true
+
+	if s.easingDuration.Milliseconds() < ServoMovementSpeedMS {
+		s.easingDuration = time.Duration(ServoMovementSpeedMS) * time.Millisecond
 	}
+
+	return nil
 }
 
+func (s *Servo) IsAttached() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return !s.detached
+}
+
+// Stop halts the servo's own loop, waiting for it to finish; calling it on a
+// servo that isn't running does nothing
 func (s *Servo) Stop() {
-	if s.stopWorkChannel != nil {
-		s.stopWorkChannel <- true
-		close(s.stopWorkChannel)
+	s.mutex.Lock()
+	stopWorkChannel, doneChannel := s.stopWorkChannel, s.doneChannel
+	s.stopWorkChannel, s.doneChannel = nil, nil
+	s.mutex.Unlock()
+
+	if stopWorkChannel == nil {
+		return
 	}
+
+	close(stopWorkChannel)
+	<-doneChannel
 }
 
+// Start steps the servo from its own goroutine until Stop is called; calling it
+// on a servo that is already running does nothing
 func (s *Servo) Start() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stopWorkChannel != nil {
+		return
+	}
+
+	s.stopWorkChannel = make(chan bool)
+	s.doneChannel = make(chan bool)
+
+	go s.work(s.stopWorkChannel, s.doneChannel)
+}
+
+func (s *Servo) work(stopWorkChannel, doneChannel chan bool) {
+	defer close(doneChannel)
+
 	for {
 		select {
-		case <-s.stopWorkChannel:
+		case <-stopWorkChannel:
 			return
 		case <-time.After(time.Duration(ServoMovementSpeedMS) * time.Millisecond):
 			s.performStep()
@@ -85,13 +331,49 @@ func (s *Servo) Start() {
 }
 
 func (s *Servo) performStep() {
-	elapsedTime := float32(time.Since(s.easingStartTime).Milliseconds())
+	pwm, changed := s.calculateStep(time.Now())
+	if !changed {
+		return
+	}
+
+	// the servo may have been detached since the step was worked out, in which case
+	// its off pulse has to stay the last thing written
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.detached {
+		s.controller.SetPWM(s.channel, 0, pwm)
+	}
+}
+
+// calculateStep works out where the servo should be at the given time, returning
+// the new pwm and whether or not it needs sending to the controller
+func (s *Servo) calculateStep(now time.Time) (int, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.detached {
+		s.updateTemperature(now, 0)
+		return int(s.currentPWM), false
+	}
+
+	// a freshly attached servo needs a pulse whether it's moving or not
+	pendingPulse := s.pendingPulse
+	s.pendingPulse = false
+
+	elapsedTime := float32(now.Sub(s.easingStartTime).Milliseconds())
 	changeInPWM := float32(s.endingPWM - s.beginningPWM)
 
-	newPWM := easings.LinearNone(elapsedTime, s.beginningPWM, changeInPWM, float32(s.easingDuration.Milliseconds()))
+	newPWM := s.easing(elapsedTime, s.beginningPWM, changeInPWM, float32(s.easingDuration.Milliseconds()))
+
+	// not every easing settles on the ending value once the duration has passed
+	if now.Sub(s.easingStartTime) >= s.easingDuration {
+		newPWM = s.endingPWM
+	}
 
 	if math.IsNaN(float64(newPWM)) {
-		return
+		s.updateTemperature(now, 0)
+		return int(s.currentPWM), pendingPulse
 	}
 
 	if (changeInPWM > 0) && (newPWM > s.endingPWM) {
@@ -100,8 +382,12 @@ func (s *Servo) performStep() {
 		newPWM = s.endingPWM
 	}
 
-	if int(newPWM) != int(s.currentPWM) {
-		s.controller.SetPWM(s.channel, 0, int(newPWM))
-		s.currentPWM = newPWM
+	if int(newPWM) == int(s.currentPWM) {
+		s.updateTemperature(now, 0)
+		return int(s.currentPWM), pendingPulse
 	}
+
+	s.updateTemperature(now, s.servoType.ConvertPWMToAngle(int(newPWM))-s.servoType.ConvertPWMToAngle(int(s.currentPWM)))
+	s.currentPWM = newPWM
+	return int(newPWM), true
 }
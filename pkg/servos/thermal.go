@@ -0,0 +1,98 @@
+package servos
+
+import (
+	"math"
+	"time"
+)
+
+// ThermalModel is a rough, first order estimate of how hot a servo's motor gets. Heat
+// comes in from holding a position against a load and from moving, and leaks out in
+// proportion to how far above ambient the servo is.
+type ThermalModel struct {
+	// degrees celsius
+	AmbientTemperature float32 `json:"ambientTemperature"`
+
+	// degrees celsius per second while powered and holding a full load
+	HoldingHeatRate float32 `json:"holdingHeatRate"`
+
+	// degrees celsius per degree of travel
+	MotionHeat float32 `json:"motionHeat"`
+
+	// fraction of the difference to ambient lost every second
+	CoolingRate float32 `json:"coolingRate"`
+}
+
+// DefaultThermalModel is a guess for a DS3225 with the body's weight on it; at a full
+// load it settles around 85C
+var DefaultThermalModel = ThermalModel{
+	AmbientTemperature: 25,
+	HoldingHeatRate:    0.3,
+	MotionHeat:         0.002,
+	CoolingRate:        0.005,
+}
+
+func (s *Servo) SetThermalModel(model ThermalModel) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.thermalModel = model
+}
+
+// SetHoldingLoad sets how much of a full load (0 to 1) the servo is holding up, which
+// scales the heat it picks up while holding a position
+func (s *Servo) SetHoldingLoad(load float32) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.holdingLoad = float32(math.Max(0, math.Min(1, float64(load))))
+}
+
+func (s *Servo) GetTemperature() float32 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.temperature
+}
+
+// ProjectTemperature estimates how hot the servo will be after horizon if it carries
+// on doing what it's doing now
+func (s *Servo) ProjectTemperature(horizon time.Duration) float32 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	model := s.thermalModel
+	if model.CoolingRate <= 0 {
+		return s.temperature + s.holdingHeatRate()*float32(horizon.Seconds())
+	}
+
+	// the temperature closes in on the steady state exponentially
+	steadyState := model.AmbientTemperature + s.holdingHeatRate()/model.CoolingRate
+	decay := float32(math.Exp(-float64(model.CoolingRate) * horizon.Seconds()))
+
+	return steadyState + (s.temperature-steadyState)*decay
+}
+
+func (s *Servo) holdingHeatRate() float32 {
+	if s.detached {
+		return 0
+	}
+
+	return s.thermalModel.HoldingHeatRate * s.holdingLoad
+}
+
+// updateTemperature moves the model along to now; the servo's mutex must be held
+func (s *Servo) updateTemperature(now time.Time, travel float32) {
+	if s.lastThermalUpdate.IsZero() || now.Before(s.lastThermalUpdate) {
+		s.lastThermalUpdate = now
+		return
+	}
+
+	elapsed := float32(now.Sub(s.lastThermalUpdate).Seconds())
+	s.lastThermalUpdate = now
+
+	model := s.thermalModel
+	heat := s.holdingHeatRate()*elapsed + model.MotionHeat*float32(math.Abs(float64(travel)))
+	cooling := model.CoolingRate * (s.temperature - model.AmbientTemperature) * elapsed
+
+	s.temperature += heat - cooling
+}
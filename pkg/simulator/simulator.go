@@ -0,0 +1,96 @@
+// Package simulator - A stand in for a PCA9685 board so the robot can be driven
+// without any hardware attached
+package simulator
+
+import (
+	"fmt"
+	"sync"
+)
+
+const ChannelCount = 16
+
+type Controller struct {
+	mutex   sync.Mutex
+	address uint8
+	on      [ChannelCount]int
+	off     [ChannelCount]int
+	writes  uint64
+
+	// optional, called after every channel update (ie - for printing or visualising)
+	OnUpdate func(address uint8, channel, on, off int)
+}
+
+func New(address uint8) *Controller {
+	return &Controller{
+		address: address,
+	}
+}
+
+func (c *Controller) GetAddr() uint8 {
+	return c.address
+}
+
+func (c *Controller) SetPWM(channel, on, off int) error {
+	if (channel < 0) || (channel >= ChannelCount) {
+		return fmt.Errorf("invalid channel value")
+	}
+
+	c.mutex.Lock()
+	c.on[channel] = on
+	c.off[channel] = off
+	c.writes++
+	c.mutex.Unlock()
+
+	if c.OnUpdate != nil {
+		c.OnUpdate(c.address, channel, on, off)
+	}
+
+	return nil
+}
+
+func (c *Controller) SetPWMs(channel, on int, offs []int) error {
+	if (channel < 0) || (channel+len(offs) > ChannelCount) {
+		return fmt.Errorf("invalid channel value")
+	}
+
+	for i, off := range offs {
+		if err := c.SetPWM(channel+i, on, off); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Controller) GetPWM(channel int, off bool) (int, error) {
+	if (channel < 0) || (channel >= ChannelCount) {
+		return 0, fmt.Errorf("invalid channel value")
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if off {
+		return c.off[channel], nil
+	}
+
+	return c.on[channel], nil
+}
+
+// GetWrites returns how many channel updates the controller has received
+func (c *Controller) GetWrites() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.writes
+}
+
+func (c *Controller) Reset() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.on = [ChannelCount]int{}
+	c.off = [ChannelCount]int{}
+
+	return nil
+}
@@ -58,6 +58,9 @@ func main() {
 
 	defer driver2.Reset()
 
+	// every leg takes the same angles for a pose; the left legs' servo types are
+	// inverted to make up for them being mounted as a mirror image of the right
+
 	// startup pose
 	// coxa = 0
 	// femur = 120
@@ -76,32 +79,32 @@ func main() {
 	r1Coxa, _ := servos.New(0, driver1, servos.ServoType_RightLeg1_Coxa, 0)
 	r1Femur, _ := servos.New(1, driver1, servos.ServoType_RightLeg1_Femur, 0)
 	r1Tibia, _ := servos.New(2, driver1, servos.ServoType_RightLeg1_Tibia, 0)
-	r1Leg := legs.New(r1Coxa, r1Femur, r1Tibia)
+	r1Leg := legs.New(legs.Right, r1Coxa, r1Femur, r1Tibia)
 
 	r2Coxa, _ := servos.New(3, driver1, servos.ServoType_RightLeg2_Coxa, 0)
 	r2Femur, _ := servos.New(4, driver1, servos.ServoType_RightLeg2_Femur, 0)
 	r2Tibia, _ := servos.New(5, driver1, servos.ServoType_RightLeg2_Tibia, 0)
-	r2Leg := legs.New(r2Coxa, r2Femur, r2Tibia)
+	r2Leg := legs.New(legs.Right, r2Coxa, r2Femur, r2Tibia)
 
 	r3Coxa, _ := servos.New(6, driver1, servos.ServoType_RightLeg3_Coxa, 0)
 	r3Femur, _ := servos.New(7, driver1, servos.ServoType_RightLeg3_Femur, 0)
 	r3Tibia, _ := servos.New(8, driver1, servos.ServoType_RightLeg3_Tibia, 0)
-	r3Leg := legs.New(r3Coxa, r3Femur, r3Tibia)
+	r3Leg := legs.New(legs.Right, r3Coxa, r3Femur, r3Tibia)
 
 	l1Coxa, _ := servos.New(0, driver2, servos.ServoType_LeftLeg1_Coxa, 0)
 	l1Femur, _ := servos.New(1, driver2, servos.ServoType_LeftLeg1_Femur, 0)
 	l1Tibia, _ := servos.New(2, driver2, servos.ServoType_LeftLeg1_Tibia, 0)
-	l1Leg := legs.New(l1Coxa, l1Femur, l1Tibia)
+	l1Leg := legs.New(legs.Left, l1Coxa, l1Femur, l1Tibia)
 
 	l2Coxa, _ := servos.New(3, driver2, servos.ServoType_LeftLeg2_Coxa, 0)
 	l2Femur, _ := servos.New(4, driver2, servos.ServoType_LeftLeg2_Femur, 0)
 	l2Tibia, _ := servos.New(5, driver2, servos.ServoType_LeftLeg2_Tibia, 0)
-	l2Leg := legs.New(l2Coxa, l2Femur, l2Tibia)
+	l2Leg := legs.New(legs.Left, l2Coxa, l2Femur, l2Tibia)
 
 	l3Coxa, _ := servos.New(6, driver2, servos.ServoType_LeftLeg3_Coxa, 0)
 	l3Femur, _ := servos.New(7, driver2, servos.ServoType_LeftLeg3_Femur, 0)
 	l3Tibia, _ := servos.New(8, driver2, servos.ServoType_LeftLeg3_Tibia, 0)
-	l3Leg := legs.New(l3Coxa, l3Femur, l3Tibia)
+	l3Leg := legs.New(legs.Left, l3Coxa, l3Femur, l3Tibia)
 
 	r1Leg.Start()
 	defer r1Leg.Stop()
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/carldanley/hexapod/pkg/geometry"
+	"github.com/carldanley/hexapod/pkg/hexapod"
+	"github.com/carldanley/hexapod/pkg/legs"
+	"github.com/carldanley/hexapod/pkg/servos"
+)
+
+// colours the legs are drawn in, in layout order
+var workspaceColours = []string{"#e6194b", "#3cb44b", "#4363d8", "#f58231", "#911eb4", "#42d4f4"}
+
+type legWorkspace struct {
+	name      string
+	leg       legs.Leg
+	workspace *legs.Workspace
+}
+
+func runWorkspace(args []string) error {
+	flags := flag.NewFlagSet("workspace", flag.ExitOnError)
+	file := flags.String("file", servos.DefaultCalibrationPath, "calibration file to take the joint limits from")
+	format := flags.String("format", "csv", "output format: csv (every reachable point) or svg (a slice from above)")
+	output := flags.String("out", "", "file to write to (defaults to stdout)")
+	resolution := flags.Float64("resolution", legs.DefaultWorkspaceResolution, "voxel size in millimetres")
+	height := flags.Float64("height", -90, "foot height (in millimetres, body frame) for the svg slice and stride summary")
+	only := flags.String("leg", "", "only export the named leg (ie - RightLeg1)")
+	flags.Parse(args)
+
+	if (*format != "csv") && (*format != "svg") {
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+
+	// nothing gets powered, the legs are only needed for their geometry and limits
+	hp, err := hexapod.New(&hexapod.Options{
+		CalibrationPath: *file,
+		Simulated:       true,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	defer hp.Shutdown()
+
+	workspaces := []legWorkspace{}
+	for i, layout := range hexapod.DefaultLayout {
+		if (*only != "") && (layout.Name != *only) {
+			continue
+		}
+
+		leg := hp.GetLeg(i)
+		workspace, err := leg.BuildWorkspace(*resolution)
+		if err != nil {
+			return fmt.Errorf("%s: %w", layout.Name, err)
+		}
+
+		workspaces = append(workspaces, legWorkspace{layout.Name, leg, workspace})
+	}
+
+	if len(workspaces) == 0 {
+		return fmt.Errorf("unknown leg: %s", *only)
+	}
+
+	writer := io.Writer(os.Stdout)
+	if *output != "" {
+		outputFile, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+
+		defer outputFile.Close()
+		writer = outputFile
+	}
+
+	buffered := bufio.NewWriter(writer)
+	if *format == "svg" {
+		err = writeWorkspaceSVG(buffered, workspaces, *height)
+	} else {
+		err = writeWorkspaceCSV(buffered, workspaces)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	printStrideSummary(workspaces, *height)
+
+	return buffered.Flush()
+}
+
+// sliceCentre returns the reachable point closest to the middle of everything the
+// foot can reach at the given height, which makes a reasonable neutral foot position;
+// the middle itself can fall outside a crescent shaped slice
+func sliceCentre(workspace *legs.Workspace, height float64) (geometry.Vector, bool) {
+	slice := workspace.GetSlice(height)
+	if len(slice) == 0 {
+		return geometry.Vector{}, false
+	}
+
+	centroid := geometry.Vector{}
+	for _, point := range slice {
+		centroid = centroid.Add(point)
+	}
+
+	centroid = centroid.Scale(1 / float64(len(slice)))
+
+	centre := slice[0]
+	for _, point := range slice[1:] {
+		if point.Sub(centroid).Length() < centre.Sub(centroid).Length() {
+			centre = point
+		}
+	}
+
+	centre.Z = height
+
+	return centre, true
+}
+
+func printStrideSummary(workspaces []legWorkspace, height float64) {
+	fmt.Fprintf(os.Stderr, "max stride at height %.1fmm:\n", height)
+
+	for _, lw := range workspaces {
+		neutral, ok := sliceCentre(lw.workspace, height)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "  %-10s unreachable\n", lw.name)
+			continue
+		}
+
+		fmt.Fprintf(os.Stderr, "  %-10s neutral %s forward %.1fmm sideways %.1fmm\n", lw.name, neutral,
+			lw.workspace.MaxStride(height, neutral, 0), lw.workspace.MaxStride(height, neutral, 90))
+	}
+}
+
+func writeWorkspaceCSV(writer io.Writer, workspaces []legWorkspace) error {
+	csvWriter := csv.NewWriter(writer)
+	if err := csvWriter.Write([]string{"leg", "x", "y", "z"}); err != nil {
+		return err
+	}
+
+	format := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', 2, 64)
+	}
+
+	for _, lw := range workspaces {
+		for _, point := range lw.workspace.GetPoints() {
+			if err := csvWriter.Write([]string{lw.name, format(point.X), format(point.Y), format(point.Z)}); err != nil {
+				return err
+			}
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// writeWorkspaceSVG draws each leg's reachable slice from above, with forward pointing
+// up the page and the body's left on the left
+func writeWorkspaceSVG(writer io.Writer, workspaces []legWorkspace, height float64) error {
+	extent := 0.0
+	for _, lw := range workspaces {
+		for _, point := range lw.workspace.GetSlice(height) {
+			extent = math.Max(extent, math.Max(math.Abs(point.X), math.Abs(point.Y)))
+		}
+	}
+
+	size := workspaces[0].workspace.GetResolution()
+	extent += 2 * size
+
+	fmt.Fprintf(writer, "<svg xmlns=\"http://www.w3.org/2000/svg\" viewBox=\"%.1f %.1f %.1f %.1f\">\n", -extent, -extent, 2*extent, 2*extent)
+	fmt.Fprintf(writer, "  <rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"white\"/>\n", -extent, -extent, 2*extent, 2*extent)
+
+	for i, lw := range workspaces {
+		colour := workspaceColours[i%len(workspaceColours)]
+
+		fmt.Fprintf(writer, "  <g fill=\"%s\" fill-opacity=\"0.4\">\n", colour)
+		for _, point := range lw.workspace.GetSlice(height) {
+			fmt.Fprintf(writer, "    <rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\"/>\n", -point.Y-size/2, -point.X-size/2, size, size)
+		}
+
+		fmt.Fprintf(writer, "  </g>\n")
+
+		mount := lw.leg.GetGeometry().Position
+		fmt.Fprintf(writer, "  <circle cx=\"%.1f\" cy=\"%.1f\" r=\"%.1f\" fill=\"%s\"/>\n", -mount.Y, -mount.X, size/2, colour)
+		fmt.Fprintf(writer, "  <text x=\"%.1f\" y=\"%.1f\" font-size=\"%.1f\">%s</text>\n", -mount.Y, -mount.X-size, 1.5*size, lw.name)
+	}
+
+	_, err := fmt.Fprintf(writer, "</svg>\n")
+	return err
+}